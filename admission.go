@@ -0,0 +1,81 @@
+package animportal
+
+import (
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const defRetryAfter = 30 * time.Second
+
+var (
+	ErrTooMany      = errors.New("too many sessions")
+	ErrTooManyOwner = errors.New("too many sessions of the owner")
+	ErrTooManyHall  = errors.New("too many sessions in the hall")
+)
+
+// slots counts sessions from admission till they are over, the ones being set up included
+type slots struct {
+	mu     sync.Mutex
+	total  int
+	owners map[string]int
+	halls  map[string]int
+}
+
+// admit() takes a slot if caps allow, release() is to be called once the session is over
+func (ap *AnimationPortal) admit(owner string, hall string) (release func(), err error) {
+	s := &ap.slots
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch {
+	case ap.MaxSessions > 0 && s.total >= ap.MaxSessions:
+		err = ErrTooMany
+	case ap.MaxPerOwner > 0 && s.owners[owner] >= ap.MaxPerOwner:
+		err = ErrTooManyOwner
+	case ap.MaxPerHall > 0 && s.halls[hall] >= ap.MaxPerHall:
+		err = ErrTooManyHall
+	}
+	if err != nil {
+		return
+	}
+
+	if s.owners == nil {
+		s.owners = make(map[string]int)
+		s.halls = make(map[string]int)
+	}
+	s.total++
+	s.owners[owner]++
+	s.halls[hall]++
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			s.total--
+			if s.owners[owner]--; s.owners[owner] == 0 {
+				delete(s.owners, owner)
+			}
+			if s.halls[hall]--; s.halls[hall] == 0 {
+				delete(s.halls, hall)
+			}
+		})
+	}
+	return
+}
+
+// reject() replies 429, with the time to retry after
+func (ap *AnimationPortal) reject(r *fasthttp.RequestCtx, err error) {
+	d := ap.RetryAfter
+	if d <= 0 {
+		d = defRetryAfter
+	}
+	// whole seconds, rounded up: 0 would invite an immediate retry
+	r.Response.Header.Set(fasthttp.HeaderRetryAfter, strconv.Itoa(int((d+time.Second-1)/time.Second)))
+	writeError(r, fasthttp.StatusTooManyRequests, err.Error())
+}
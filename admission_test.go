@@ -0,0 +1,84 @@
+package animportal
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/dmisol/animportal/defs"
+	"github.com/valyala/fasthttp"
+)
+
+func TestAdmit(t *testing.T) {
+	ap := &AnimationPortal{PortalConf: &defs.PortalConf{MaxSessions: 3, MaxPerOwner: 2, MaxPerHall: 2}}
+
+	r1, err := ap.admit("bob", "ft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := ap.admit("bob", "other")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ap.admit("bob", "ft"); err != ErrTooManyOwner {
+		t.Fatal("ErrTooManyOwner expected, got", err)
+	}
+	r3, err := ap.admit("alice", "ft")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ap.admit("eve", "ft"); err != ErrTooMany {
+		t.Fatal("ErrTooMany expected, got", err)
+	}
+
+	r2()
+	r2() // once
+	if _, err = ap.admit("eve", "ft"); err != ErrTooManyHall {
+		t.Fatal("ErrTooManyHall expected, got", err)
+	}
+	r1()
+	r3()
+	if ap.slots.total != 0 || len(ap.slots.owners) != 0 || len(ap.slots.halls) != 0 {
+		t.Fatal("slots left", ap.slots.total, ap.slots.owners, ap.slots.halls)
+	}
+}
+
+func TestHandlerTooMany(t *testing.T) {
+	ap := &AnimationPortal{PortalConf: &defs.PortalConf{MaxPerOwner: 1}, sessions: make(map[string]*user)}
+	release, _ := ap.admit("bob", "ft")
+	defer release()
+
+	r := &fasthttp.RequestCtx{}
+	r.Request.SetRequestURI("/animate?name=bob")
+	ap.Handler(r)
+
+	if r.Response.StatusCode() != fasthttp.StatusTooManyRequests {
+		t.Fatal("expected 429, got", r.Response.StatusCode())
+	}
+	if ra := string(r.Response.Header.Peek(fasthttp.HeaderRetryAfter)); ra != "30" {
+		t.Fatal("unexpected Retry-After", ra)
+	}
+	var e errorReply
+	if err := json.Unmarshal(r.Response.Body(), &e); err != nil || e.Error != ErrTooManyOwner.Error() {
+		t.Fatal("unexpected reply", string(r.Response.Body()), err)
+	}
+	if ap.slots.total != 1 {
+		t.Fatal("slot taken by the rejected")
+	}
+
+	for _, c := range []struct {
+		d  time.Duration
+		ra string
+	}{
+		{100 * time.Millisecond, "1"},
+		{time.Second, "1"},
+		{1500 * time.Millisecond, "2"},
+	} {
+		ap.RetryAfter = c.d
+		r = &fasthttp.RequestCtx{}
+		ap.reject(r, ErrTooMany)
+		if ra := string(r.Response.Header.Peek(fasthttp.HeaderRetryAfter)); ra != c.ra {
+			t.Fatal(c.d, "unexpected Retry-After", ra)
+		}
+	}
+}
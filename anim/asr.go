@@ -0,0 +1,161 @@
+package anim
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/dmisol/animportal/defs"
+	"github.com/dmisol/animportal/vosk"
+	"github.com/dmisol/animportal/wire"
+)
+
+const asrFifo = 10 // chunks waiting for vosk, dropped if it lags
+
+// asr streams all pcm, silence included, to vosk and sends the results as defs.Anim
+// vad -> asr -> animation
+type asr struct {
+	dest animWriter
+	*vosk.Client
+
+	fifo chan asrChunk
+	quit chan struct{}
+	done chan struct{}
+	once sync.Once
+
+	// feed() only
+	sent time.Duration // pcm sent, vosk time
+	next time.Duration // media expected with the next chunk
+
+	mu    sync.Mutex
+	syncs []asrSync // where media is discontinuous: a pause, dropped chunks
+}
+
+type asrChunk struct {
+	media time.Duration
+	pcm   []byte
+}
+
+// asrSync maps vosk time to media, till the next one
+type asrSync struct {
+	vosk  time.Duration
+	media time.Duration
+}
+
+func newAsr(ctx context.Context, dest animWriter, url string) (a *asr, err error) {
+	a = &asr{
+		dest: dest,
+		fifo: make(chan asrChunk, asrFifo),
+		quit: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if a.Client, err = vosk.Dial(ctx, url, voskRate, a.onResult); err != nil {
+		a = nil
+		return
+	}
+	go a.feed()
+	return
+}
+
+func (a *asr) WriteChunk(media time.Duration, pcm []byte) error {
+	a.recognize(media, pcm)
+	return a.dest.WriteChunk(media, pcm)
+}
+
+func (a *asr) WriteIdle(media time.Duration, pcm []byte) error {
+	a.recognize(media, pcm)
+	return a.dest.WriteIdle(media, pcm)
+}
+
+func (a *asr) WriteAnim(anim *defs.Anim, pcm []byte) error {
+	return a.dest.WriteAnim(anim, pcm)
+}
+
+// recognize() never blocks nor fails the chunk, recognition is optional
+func (a *asr) recognize(media time.Duration, pcm []byte) {
+	select {
+	case a.fifo <- asrChunk{media: media, pcm: pcm}:
+	default:
+	}
+}
+
+// feed() writes to vosk off the pcm path; once stopped, the rest of the fifo goes
+func (a *asr) feed() {
+	defer close(a.done)
+	defer a.Client.Close()
+
+	for {
+		select {
+		case c := <-a.fifo:
+			if !a.write(c) {
+				return
+			}
+		case <-a.quit:
+			for {
+				select {
+				case c := <-a.fifo:
+					if !a.write(c) {
+						return
+					}
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *asr) write(c asrChunk) bool {
+	if len(a.syncs) == 0 || c.media != a.next {
+		a.mu.Lock()
+		a.syncs = append(a.syncs, asrSync{vosk: a.sent, media: c.media})
+		a.mu.Unlock()
+	}
+	if _, err := a.Client.Write(c.pcm); err != nil {
+		a.Println("asr", err)
+		return false
+	}
+	d := time.Duration(len(c.pcm)/pcmBytesPerMs) * time.Millisecond
+	a.sent += d
+	a.next = c.media + d
+	return true
+}
+
+// onResult() restamps phones from vosk time to media
+func (a *asr) onResult(phones []*defs.Viseme) {
+	a.mu.Lock()
+	first := -1
+	for _, p := range phones {
+		t := time.Duration(p.Time) * time.Millisecond
+		i := len(a.syncs) - 1
+		for i > 0 && a.syncs[i].vosk > t {
+			i--
+		}
+		if first < 0 {
+			first = i
+		}
+		if i >= 0 {
+			p.Time = int((a.syncs[i].media + t - a.syncs[i].vosk).Milliseconds())
+		}
+	}
+	if first > 0 {
+		// results come in order
+		a.syncs = a.syncs[first:]
+	}
+	a.mu.Unlock()
+
+	err := a.dest.WriteAnim(&defs.Anim{Ts: phones[0].Time, Phones: phones}, nil)
+	if errors.Is(err, wire.ErrVersion) {
+		a.Println("asr", err)
+		go a.stop()
+	}
+}
+
+// stop() stops sending pcm and waits for the final result, the session goes on
+func (a *asr) stop() {
+	a.once.Do(func() {
+		close(a.quit)
+	})
+	<-a.done
+}
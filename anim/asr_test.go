@@ -0,0 +1,82 @@
+package anim
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dmisol/animportal/defs"
+	"github.com/gorilla/websocket"
+)
+
+type recognized struct {
+	gated
+	anims chan *defs.Anim
+}
+
+func (r *recognized) WriteAnim(a *defs.Anim, pcm []byte) error {
+	r.anims <- a
+	return nil
+}
+
+// fakeVosk recognizes a word at the start of each pcm message, in vosk time
+func fakeVosk(t *testing.T) *httptest.Server {
+	up := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer c.Close()
+
+		var at float64 // s
+		for {
+			typ, b, err := c.ReadMessage()
+			if err != nil || (typ == websocket.TextMessage && strings.Contains(string(b), "eof")) {
+				return
+			}
+			if typ != websocket.BinaryMessage {
+				continue
+			}
+			c.WriteMessage(websocket.TextMessage, []byte(fmt.Sprintf(`{"result": [{"word": "a", "start": %.3f, "end": %.3f, "conf": 1}]}`, at, at+0.01)))
+			at += float64(len(b)) / 2 / voskRate
+		}
+	}))
+}
+
+func TestAsrStamps(t *testing.T) {
+	srv := fakeVosk(t)
+	defer srv.Close()
+
+	dest := &recognized{anims: make(chan *defs.Anim, 10)}
+	a, err := newAsr(context.Background(), dest, "ws"+strings.TrimPrefix(srv.URL, "http"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// media jumps after a pause, vosk time does not
+	for _, ms := range []int{0, 50, 1000, 1050} {
+		a.WriteChunk(time.Duration(ms)*time.Millisecond, make([]byte, 50*pcmBytesPerMs))
+	}
+	for _, ms := range []int{0, 50, 1000, 1050} {
+		select {
+		case an := <-dest.anims:
+			if an.Ts != ms || an.Phones[0].Time != ms {
+				t.Fatal("expected", ms, "got", an.Ts, an.Phones[0].Time)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("no result")
+		}
+	}
+	a.stop()
+
+	// nobody drains the fifo, chunks are dropped
+	for i := 0; i < 2*asrFifo; i++ {
+		a.WriteChunk(0, make([]byte, 50*pcmBytesPerMs))
+	}
+}
@@ -1,16 +1,12 @@
 package anim
 
-// #cgo linux CFLAGS: -I/usr/include/opus
-// #cgo linux LDFLAGS: -L/usr/lib/x86_64-linux-gnu -lopus
-// #include <opus.h>
-import "C"
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"io"
 	"log"
-	"sync"
 	"sync/atomic"
 	"time"
 
@@ -24,6 +20,11 @@ const (
 	audiochan = 1
 	opusRate  = 48000
 	voskRate  = 16000
+
+	relayFifo  = 100 // decoded packets waiting for relay
+	maxConceal = 10  // lost frames in a row to be synthesized
+
+	flushTimeout = time.Second // to send the rest of pcm on close
 )
 
 var (
@@ -39,43 +40,116 @@ func newConv(dest io.Writer) (c *conv) {
 		c.Println("resampler creating", err)
 	}
 
-	e := C.int(0)
-	er := &e
-	c.dec = C.opus_decoder_create(C.int(opusRate), C.int(audiochan), er)
-
+	if c.dec, err = newOpusDecoder(); err != nil {
+		c.Println("decoder creating", err)
+	}
 	return
 }
 
 type conv struct {
 	dest io.Writer
-	dec  *C.OpusDecoder
+	dec  decoder
 	res  *resample.Resampler
 	b    []byte
+
+	started bool
+	next    uint16 // expected sequence number
+	frame   int    // samples in the last decoded frame, for plc
+
+	stats ConcealStats
+}
+
+// ConcealStats counts frames synthesized to keep pcm continuous
+type ConcealStats struct {
+	Fec    int64 `json:"fec"`    // recovered from in-band fec of the next packet
+	Plc    int64 `json:"plc"`    // guessed by the decoder
+	Failed int64 `json:"failed"` // broken packets, concealed with plc
 }
 
+// Close() flushes the resampler to dest
 func (c *conv) Close() error {
-	C.opus_decoder_destroy(c.dec)
+	c.dec.Close()
+	if c.res != nil {
+		return c.res.Close()
+	}
 	return nil
 }
 
+// AppendRTP() decodes packets given in sequence order; the lost ones are concealed
+// the last lost packet is recovered with fec when the next one carries it, the others with plc
 func (c *conv) AppendRTP(rtp *rtp.Packet) (err error) {
+	if len(rtp.Payload) == 0 {
+		return
+	}
+	// packets may carry several frames
+	frame := c.dec.Samples(rtp.Payload)
+
+	if c.started {
+		lost := int(rtp.SequenceNumber - c.next)
+		if lost > maxConceal {
+			// too long to guess, let it be a hole
+			c.Println("gap", lost, "not concealed")
+			lost = 0
+		}
+		for i := 0; i < lost; i++ {
+			if i == lost-1 && hasLbrr(rtp.Payload) {
+				if err = c.decode(rtp.Payload, c.frame, true); err == nil {
+					atomic.AddInt64(&c.stats.Fec, 1)
+					continue
+				}
+			}
+			if err = c.decode(nil, c.frame, false); err != nil {
+				return
+			}
+			atomic.AddInt64(&c.stats.Plc, 1)
+		}
+	}
+	c.started = true
+	c.next = rtp.SequenceNumber + 1
 
-	samplesPerFrame := int(C.opus_packet_get_samples_per_frame((*C.uchar)(&rtp.Payload[0]), C.int(48000)))
-	pcm := make([]int16, samplesPerFrame)
-	samples := C.opus_decode(c.dec, (*C.uchar)(&rtp.Payload[0]), C.opus_int32(len(rtp.Payload)), (*C.opus_int16)(&pcm[0]), C.int(cap(pcm)/audiochan), 0)
-	if samples < 0 {
+	if frame <= 0 {
 		err = ErrDecoding
+	} else {
+		err = c.decode(rtp.Payload, frame, false)
+	}
+	if err != nil {
+		// pcm goes on, concealed
+		atomic.AddInt64(&c.stats.Failed, 1)
+		c.Println("broken packet", rtp.SequenceNumber, err)
+		err = c.decode(nil, c.frame, false)
 		return
 	}
-	pcmData := make([]byte, 0)
-	pcmBuffer := bytes.NewBuffer(pcmData)
-	for _, v := range pcm {
+	c.frame = frame
+	return
+}
+
+// decode() decodes frame samples, or conceals them if data is nil, and sends pcm for resampling
+func (c *conv) decode(data []byte, frame int, fec bool) (err error) {
+	if frame <= 0 {
+		frame = opusRate / 50 // 20 ms
+	}
+	pcm := make([]int16, frame*audiochan)
+
+	var samples int
+	if samples, err = c.dec.Decode(data, pcm, fec); err != nil {
+		return
+	}
+	pcmBuffer := bytes.NewBuffer(make([]byte, 0, 2*len(pcm)))
+	for _, v := range pcm[:samples*audiochan] {
 		binary.Write(pcmBuffer, binary.LittleEndian, v)
 	}
 	err = c.AppendBytes(pcmBuffer.Bytes())
 	return
 }
 
+func (c *conv) Concealed() ConcealStats {
+	return ConcealStats{
+		Fec:    atomic.LoadInt64(&c.stats.Fec),
+		Plc:    atomic.LoadInt64(&c.stats.Plc),
+		Failed: atomic.LoadInt64(&c.stats.Failed),
+	}
+}
+
 func (c *conv) AppendBytes(b []byte) (err error) {
 	if _, err = c.res.Write(b); err != nil {
 		c.Println("resampling", err)
@@ -87,74 +161,110 @@ func (c *conv) Println(i ...interface{}) {
 	log.Println("conv", i)
 }
 
+// audioPacket remembers when the packet was received, to be relayed with lip-sync delay
+type audioPacket struct {
+	*rtp.Packet
+	at time.Time
+}
+
+// AudioProc orders incoming opus packets, decodes them for animation
+// and keeps them for the relay:
+// remote -> jitter buffer -> conv -> chunker -> vad -> animation, relay fifo
 type AudioProc struct {
-	mu   sync.Mutex
-	fifo []*rtp.Packet
 	*conv
+	chunks *chunker
+	vad    *vad
+	jb     *jitterBuffer
+	fifo   chan *audioPacket
+	done   chan struct{} // decoding is over, pcm is flushed
 
-	sinceLast int64
-	stop      chan bool
+	context.Context
+	context.CancelFunc
 }
 
-func newAudioProc(remote *webrtc.TrackRemote, anim io.Writer) (a *AudioProc) {
+func newAudioProc(ctx context.Context, remote *webrtc.TrackRemote, anim idleWriter, depth int, chunk time.Duration, clock *mediaClock, gate bool) (a *AudioProc) {
 	a = &AudioProc{
-		stop: make(chan bool),
-		conv: newConv(anim),
+		vad:  newVad(anim, gate),
+		jb:   newJitterBuffer(depth),
+		fifo: make(chan *audioPacket, relayFifo),
+		done: make(chan struct{}),
 	}
+	a.chunks = newChunker(a.vad, chunk, clock)
+	a.conv = newConv(a.chunks)
+	a.Context, a.CancelFunc = context.WithCancel(ctx)
 	go a.run(remote)
+	go a.decode()
 	return
 }
 
-func (a *AudioProc) Read(p []byte) (i int, err error) {
-	// todo: use sync.Cond
-	for {
-		if x := atomic.LoadInt64(&a.sinceLast); x > 0 {
-			break
-		}
-		time.Sleep(10 * time.Millisecond)
+// next() blocks till the next ordered packet is decoded
+func (a *AudioProc) next() (totx *audioPacket, err error) {
+	select {
+	case <-a.Context.Done():
+		err = a.Context.Err()
+	case totx = <-a.fifo:
 	}
-
-	var totx *rtp.Packet
-	func() {
-		a.mu.Lock()
-		defer a.mu.Unlock()
-
-		totx, a.fifo = a.fifo[0], a.fifo[1:]
-	}()
-
-	atomic.AddInt64(&a.sinceLast, -1)
-	i = copy(p, totx.Payload)
 	return
 }
 
+func (a *AudioProc) Stats() JitterStats {
+	return a.jb.Stats()
+}
+
+// Close() returns when the rest of pcm is sent, the animation may be closed then
 func (a *AudioProc) Close() (err error) {
 	a.Println("closing")
 
-	a.stop <- true
-	a.conv.Close()
-
+	a.CancelFunc()
+	a.jb.Close()
+	select {
+	case <-a.done:
+	case <-time.After(flushTimeout):
+		a.Println("flushing timed out")
+	}
 	return
 }
 
 func (a *AudioProc) run(remote *webrtc.TrackRemote) {
 	for {
-		select {
-		case <-a.stop:
+		p, _, err := remote.ReadRTP()
+		if err != nil {
+			a.Println("rtp rd", err)
+			return
+		}
+		if a.Context.Err() != nil {
 			a.Println("killed(ctx)")
 			return
+		}
+		a.jb.Push(&audioPacket{Packet: p, at: time.Now()})
+	}
+}
+
+// decode() owns the decoder, destroys it when done
+// the rest of pcm is flushed then, the animation is closed after the context
+func (a *AudioProc) decode() {
+	defer func() {
+		defer close(a.done)
+
+		a.conv.Close()
+		if err := a.chunks.Flush(); err != nil {
+			a.Println("flushing", err)
+		}
+	}()
+
+	for {
+		p, err := a.jb.Pop(a.Context)
+		if err != nil {
+			a.Println("decoding stopped", err)
+			return
+		}
+		if err = a.conv.AppendRTP(p.Packet); err != nil {
+			a.Println("decoding", p.SequenceNumber, err)
+		}
+		select {
+		case a.fifo <- p:
 		default:
-			p, _, err := remote.ReadRTP()
-			if err != nil {
-				a.Println("rtp rd", err)
-				return
-			}
-			func() {
-				a.mu.Lock()
-				a.mu.Unlock()
-				a.fifo = append(a.fifo, p)
-			}()
-			atomic.AddInt64(&a.sinceLast, 1)
-			a.conv.AppendRTP(p)
+			// relay is stuck, not the reason to stop animation
 		}
 	}
 }
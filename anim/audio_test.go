@@ -0,0 +1,118 @@
+package anim
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/pion/rtp"
+)
+
+// fakeDecoder knows silk nb 20 and 40 ms packets, "bad" payload is broken
+type fakeDecoder struct {
+	calls []string
+	sizes []int
+}
+
+func (f *fakeDecoder) Decode(data []byte, pcm []int16, fec bool) (int, error) {
+	switch {
+	case data == nil:
+		f.calls = append(f.calls, "plc")
+	case fec:
+		f.calls = append(f.calls, "fec")
+	case string(data) == "bad":
+		return 0, ErrDecoding
+	default:
+		f.calls = append(f.calls, "pkt")
+	}
+	f.sizes = append(f.sizes, len(pcm))
+	return len(pcm), nil
+}
+
+func (f *fakeDecoder) Samples(data []byte) int {
+	if data[0] == 0x10 {
+		return 1920
+	}
+	return 960
+}
+
+func (f *fakeDecoder) Close() error { return nil }
+
+var (
+	opusPlain = []byte{0x08, 0x80} // silk nb 20 ms, vad only
+	opusLbrr  = []byte{0x08, 0xc0} // silk nb 20 ms, lbrr of the previous
+	opusLong  = []byte{0x10, 0x80} // silk nb 40 ms, 2 frames
+)
+
+func TestConceal(t *testing.T) {
+	type pkt struct {
+		seq  uint16
+		data []byte
+	}
+	tests := []struct {
+		name  string
+		pkts  []pkt
+		calls string
+		sizes []int
+		stats ConcealStats
+	}{
+		{"in order", []pkt{{1, opusPlain}, {2, opusPlain}}, "pkt pkt", []int{960, 960}, ConcealStats{}},
+		{"gap, fec", []pkt{{1, opusPlain}, {4, opusLbrr}}, "pkt plc fec pkt", []int{960, 960, 960, 960}, ConcealStats{Fec: 1, Plc: 1}},
+		{"gap, no lbrr", []pkt{{1, opusPlain}, {4, opusPlain}}, "pkt plc plc pkt", []int{960, 960, 960, 960}, ConcealStats{Plc: 2}},
+		{"too long", []pkt{{1, opusPlain}, {2 + maxConceal + 1, opusLbrr}}, "pkt pkt", []int{960, 960}, ConcealStats{}},
+		{"wrapped", []pkt{{0xffff, opusPlain}, {1, opusPlain}}, "pkt plc pkt", []int{960, 960, 960}, ConcealStats{Plc: 1}},
+		{"multiframe", []pkt{{1, opusLong}, {3, opusLong}}, "pkt plc pkt", []int{1920, 1920, 1920}, ConcealStats{Plc: 1}},
+		{"broken", []pkt{{1, opusPlain}, {2, []byte("bad")}, {3, opusPlain}}, "pkt plc pkt", []int{960, 960, 960}, ConcealStats{Failed: 1}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dec := &fakeDecoder{}
+			c := newConv(io.Discard)
+			c.dec.Close()
+			c.dec = dec
+			defer c.Close()
+
+			for _, p := range tt.pkts {
+				if err := c.AppendRTP(&rtp.Packet{Header: rtp.Header{SequenceNumber: p.seq}, Payload: p.data}); err != nil {
+					t.Fatal(p.seq, err)
+				}
+			}
+			if got := strings.Join(dec.calls, " "); got != tt.calls {
+				t.Fatal("unexpected decoding", got)
+			}
+			for i, n := range tt.sizes {
+				if dec.sizes[i] != n {
+					t.Fatal("unexpected frame size", i, dec.sizes)
+				}
+			}
+			if s := c.Concealed(); s != tt.stats {
+				t.Fatalf("unexpected stats %+v", s)
+			}
+		})
+	}
+}
+
+func TestHasLbrr(t *testing.T) {
+	tests := []struct {
+		name string
+		pkt  []byte
+		want bool
+	}{
+		{"too short", []byte{0x08}, false},
+		{"silk 20 ms lbrr", []byte{0x08, 0xc0}, true},
+		{"silk 20 ms vad", []byte{0x08, 0x80}, false},
+		{"silk 40 ms lbrr", []byte{0x10, 0x20}, true},
+		{"silk 40 ms vad", []byte{0x10, 0xc0}, false},
+		{"silk stereo side lbrr", []byte{0x0c, 0x10}, true},
+		{"hybrid 20 ms lbrr", []byte{0x68, 0x40}, true},
+		{"celt", []byte{0x80, 0xff}, false},
+		{"code 2", []byte{0x0a, 0x01, 0x40, 0x00}, true},
+		{"code 3 cbr", []byte{0x0b, 0x02, 0x40, 0x00}, true},
+		{"code 3 vbr padded", []byte{0x0b, 0xc3, 0x01, 0x01, 0x01, 0x40}, true},
+	}
+	for _, tt := range tests {
+		if got := hasLbrr(tt.pkt); got != tt.want {
+			t.Error(tt.name, got)
+		}
+	}
+}
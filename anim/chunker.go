@@ -0,0 +1,103 @@
+package anim
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	defChunk    = 50 * time.Millisecond // 1600 bytes
+	maxMediaLag = 200 * time.Millisecond
+)
+
+// mediaClock stamps all the pcm sent for animation: owner's, synthesized, idle;
+// stamps advance by pcm duration and never overlap, after a pause they catch up with the wall clock
+type mediaClock struct {
+	mu   sync.Mutex
+	t0   time.Time
+	next time.Duration
+}
+
+func newMediaClock(t0 time.Time) *mediaClock {
+	return &mediaClock{t0: t0}
+}
+
+// stamp() takes d of media time, returns where it starts
+func (m *mediaClock) stamp(d time.Duration) (at time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now := time.Since(m.t0); now-m.next > maxMediaLag {
+		m.next = now
+	}
+	at = m.next
+	m.next += d
+	return
+}
+
+// chunkWriter receives fixed size pcm chunks, stamped with media time of their start
+type chunkWriter interface {
+	WriteChunk(media time.Duration, pcm []byte) error
+}
+
+// chunker cuts resampled pcm into chunks of the agreed duration
+// resampler -> chunker -> animation
+type chunker struct {
+	mu    sync.Mutex
+	dest  chunkWriter
+	size  int // bytes
+	buf   []byte
+	clock *mediaClock
+}
+
+func newChunker(dest chunkWriter, d time.Duration, clock *mediaClock) *chunker {
+	if d <= 0 {
+		d = defChunk
+	}
+	size := int(d.Milliseconds()) * pcmBytesPerMs
+	return &chunker{dest: dest, size: size, buf: make([]byte, 0, size), clock: clock}
+}
+
+func (c *chunker) Write(pcm []byte) (i int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(pcm) > 0 {
+		n := c.size - len(c.buf)
+		if n > len(pcm) {
+			n = len(pcm)
+		}
+		c.buf = append(c.buf, pcm[:n]...)
+		pcm = pcm[n:]
+		i += n
+
+		if len(c.buf) == c.size {
+			if err = c.emit(); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// Flush() pads the tail with silence and sends it, at the end of stream
+func (c *chunker) Flush() (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(c.buf) == 0 {
+		return
+	}
+	c.buf = append(c.buf, make([]byte, c.size-len(c.buf))...)
+	return c.emit()
+}
+
+// emit() passes a copy, the buffer is reused
+func (c *chunker) emit() (err error) {
+	media := c.clock.stamp(time.Duration(len(c.buf)/pcmBytesPerMs) * time.Millisecond)
+	pcm := make([]byte, len(c.buf))
+	copy(pcm, c.buf)
+	c.buf = c.buf[:0]
+
+	return c.dest.WriteChunk(media, pcm)
+}
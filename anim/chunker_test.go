@@ -0,0 +1,80 @@
+package anim
+
+import (
+	"testing"
+	"time"
+)
+
+type chunks struct {
+	media []time.Duration
+	pcm   [][]byte
+}
+
+func (c *chunks) WriteChunk(media time.Duration, pcm []byte) error {
+	c.media = append(c.media, media)
+	c.pcm = append(c.pcm, pcm)
+	return nil
+}
+
+func TestChunker(t *testing.T) {
+	dest := &chunks{}
+	c := newChunker(dest, 0, &mediaClock{t0: time.Now(), next: time.Second})
+	if c.size != 1600 {
+		t.Fatal("unexpected default size", c.size)
+	}
+
+	b := make([]byte, 1000)
+	for i := range b {
+		b[i] = 1
+	}
+	for i := 0; i < 4; i++ {
+		if n, err := c.Write(b); err != nil || n != len(b) {
+			t.Fatal("write", n, err)
+		}
+	}
+	if len(dest.pcm) != 2 {
+		t.Fatal("unexpected chunks", len(dest.pcm))
+	}
+	c.Flush()
+	c.Flush() // nothing left
+
+	if len(dest.pcm) != 3 {
+		t.Fatal("tail not flushed", len(dest.pcm))
+	}
+	for i, exp := range []time.Duration{1000 * time.Millisecond, 1050 * time.Millisecond, 1100 * time.Millisecond} {
+		if len(dest.pcm[i]) != 1600 || dest.media[i] != exp {
+			t.Fatal("unexpected chunk", i, len(dest.pcm[i]), dest.media[i])
+		}
+	}
+	tail := dest.pcm[2]
+	if tail[799] != 1 || tail[800] != 0 || tail[1599] != 0 {
+		t.Fatal("tail not padded")
+	}
+}
+
+func TestMediaClock(t *testing.T) {
+	clock := &mediaClock{t0: time.Now(), next: time.Second}
+	owner, speech := &chunks{}, &chunks{}
+	a, b := newChunker(owner, 0, clock), newChunker(speech, 0, clock)
+
+	// both at once, stamps do not overlap
+	for i := 0; i < 2; i++ {
+		a.Write(make([]byte, 1600))
+		b.Write(make([]byte, 1600))
+	}
+	got := []time.Duration{owner.media[0], speech.media[0], owner.media[1], speech.media[1]}
+	for i, exp := range []time.Duration{1000, 1050, 1100, 1150} {
+		if got[i] != exp*time.Millisecond {
+			t.Fatal("unexpected stamps", got)
+		}
+	}
+
+	// after a pause, the wall clock
+	clock.t0 = time.Now().Add(-10 * time.Second)
+	if at := clock.stamp(0); at < 10*time.Second {
+		t.Fatal("no catch up", at)
+	}
+	if at := clock.stamp(defChunk); clock.stamp(0) != at+defChunk {
+		t.Fatal("went back")
+	}
+}
@@ -0,0 +1,91 @@
+package anim
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/dmisol/animportal/defs"
+	"github.com/dmisol/animportal/wire"
+)
+
+var (
+	ErrControl = errors.New("Nothing to control")
+)
+
+// Control() changes pattern, glasses, hat etc of the running animation
+func (e *Engine) Control(c *defs.Control) error {
+	if c == nil || c.Empty() {
+		return ErrControl
+	}
+	return e.animation.control(c)
+}
+
+// Pause() stops animation: pcm is dropped, the video is frozen
+func (e *Engine) Pause(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&e.animation.paused, v)
+}
+
+// Mute() stops audio to the hall, the owner's and the synthesized
+func (e *Engine) Mute(on bool) {
+	var v int32
+	if on {
+		v = 1
+	}
+	atomic.StoreInt32(&e.muted, v)
+}
+
+func (e *Engine) isMuted() bool {
+	return atomic.LoadInt32(&e.muted) > 0
+}
+
+func (p *animation) isPaused() bool {
+	return atomic.LoadInt32(&p.paused) > 0
+}
+
+// dropping() tells that pcm is not to be sent: paused, or reconnecting
+func (p *animation) dropping() bool {
+	return p.isPaused() || atomic.LoadInt32(&p.down) > 0
+}
+
+// control() is sent now and replayed on reconnection; while reconnecting, it is only kept
+// all under connMu, not to get between the replay and the end of reconnection
+func (p *animation) control(c *defs.Control) error {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+
+	if p.conn.Version < wire.ControlVersion {
+		return fmt.Errorf("%w: %d, no control", wire.ErrVersion, p.conn.Version)
+	}
+	merge(&p.ctl, c)
+	if atomic.LoadInt32(&p.down) > 0 {
+		return nil
+	}
+	return p.conn.SendJson(wire.Control, c)
+}
+
+// merge() updates dst with the fields set in c
+func merge(dst *defs.Control, c *defs.Control) {
+	if len(c.Pattern) > 0 {
+		dst.Pattern = c.Pattern
+	}
+	if c.Pi != nil {
+		dst.Pi = c.Pi
+	}
+	if c.Glasses != nil {
+		dst.Glasses = c.Glasses
+	}
+	if c.Hat != nil {
+		dst.Hat = c.Hat
+	}
+	if c.Color != nil {
+		dst.Color = c.Color
+	}
+	if c.Ftar != "" {
+		dst.Ftar = c.Ftar
+	}
+}
@@ -0,0 +1,67 @@
+package anim
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/dmisol/animportal/defs"
+	"github.com/dmisol/animportal/wire"
+)
+
+func TestControl(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	e := &Engine{animation: &animation{conn: wire.NewConn(c1)}}
+	e.animation.conn.Version = wire.ControlVersion - 1
+
+	pi, hat := 3, true
+	if err := e.Control(&defs.Control{Pi: &pi, Hat: &hat}); !errors.Is(err, wire.ErrVersion) {
+		t.Fatal("ErrVersion expected, got", err)
+	}
+	e.animation.conn.Version = wire.ControlVersion
+	if err := e.Control(&defs.Control{}); err != ErrControl {
+		t.Fatal("ErrControl expected, got", err)
+	}
+
+	go e.Control(&defs.Control{Pi: &pi, Hat: &hat})
+	m, err := wire.Read(c2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &defs.Control{}
+	if m.Type != wire.Control || json.Unmarshal(m.Payload, c) != nil {
+		t.Fatal("unexpected", m.Type, string(m.Payload))
+	}
+	if c.Pi == nil || *c.Pi != 3 || c.Hat == nil || !*c.Hat || c.Glasses != nil {
+		t.Fatal("unexpected control", string(m.Payload))
+	}
+}
+
+func TestPauseMute(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	e := &Engine{animation: &animation{conn: wire.NewConn(c1), inband: true, lips: newLipSync(20), fb: newFallback(defs.InitialJson{})}}
+	e.animation.conn.Version = wire.Version
+
+	e.Pause(true)
+	e.Mute(true)
+	// nobody reads the pipe, sending would block
+	if err := e.animation.WriteChunk(0, make([]byte, 1600)); err != nil {
+		t.Fatal(err)
+	}
+	if s := e.Stats(); !s.Paused || !s.Muted || s.Chunks != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	e.Pause(false)
+	go e.animation.WriteChunk(0, make([]byte, 1600))
+	if m, err := wire.Read(c2); err != nil || m.Type != wire.Pcm {
+		t.Fatal("pcm expected", err)
+	}
+}
@@ -0,0 +1,98 @@
+package anim
+
+import (
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/dmisol/animportal/defs"
+	"github.com/gen2brain/x264-go"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	defVpxKbps = 600
+)
+
+var (
+	ErrCodec = errors.New("Unsupported video codec")
+)
+
+// Encoder compresses images and writes the stream to io.Writer, frame by frame
+type Encoder interface {
+	Encode(img image.Image) error
+	Close() error
+}
+
+// newEncoder() selects the encoder by conf.Codec; returns mime type to publish
+func newEncoder(w io.Writer, conf defs.InitialJson) (enc Encoder, mime string, err error) {
+	switch conf.Codec {
+	case "", defs.CodecH264:
+		mime = webrtc.MimeTypeH264
+		opts := &x264.Options{
+			Width:     conf.W,
+			Height:    conf.H,
+			FrameRate: conf.FPS,
+			Tune:      "zerolatency",
+			Preset:    "veryfast",
+			Profile:   "baseline",
+			LogLevel:  x264.LogDebug,
+		}
+		enc, err = x264.NewEncoder(w, opts)
+	case defs.CodecVP8:
+		mime = webrtc.MimeTypeVP8
+		enc, err = newVpxEncoder(w, false, conf.W, conf.H, conf.FPS, defVpxKbps)
+	case defs.CodecVP9:
+		mime = webrtc.MimeTypeVP9
+		enc, err = newVpxEncoder(w, true, conf.W, conf.H, conf.FPS, defVpxKbps)
+	default:
+		err = ErrCodec
+	}
+	return
+}
+
+// ivf container is what lksdk reader track expects for VPx
+// https://wiki.multimedia.cx/index.php/IVF
+func ivfHeader(fourcc string, w int, h int, fps int) (b []byte) {
+	b = make([]byte, 32)
+	copy(b[0:], "DKIF")
+	binary.LittleEndian.PutUint16(b[4:], 0)  // version
+	binary.LittleEndian.PutUint16(b[6:], 32) // header size
+	copy(b[8:], fourcc)
+	binary.LittleEndian.PutUint16(b[12:], uint16(w))
+	binary.LittleEndian.PutUint16(b[14:], uint16(h))
+	binary.LittleEndian.PutUint32(b[16:], uint32(fps)) // timebase denominator
+	binary.LittleEndian.PutUint32(b[20:], 1)           // timebase numerator
+	return
+}
+
+func ivfFrame(pts uint64, frame []byte) (b []byte) {
+	b = make([]byte, 12+len(frame))
+	binary.LittleEndian.PutUint32(b[0:], uint32(len(frame)))
+	binary.LittleEndian.PutUint64(b[4:], pts)
+	copy(b[12:], frame)
+	return
+}
+
+// toI420() converts image to planar yuv 4:2:0, if not yet
+func toI420(img image.Image) (yuv *image.YCbCr) {
+	if y, ok := img.(*image.YCbCr); ok && y.SubsampleRatio == image.YCbCrSubsampleRatio420 {
+		return y
+	}
+	r := img.Bounds()
+	yuv = image.NewYCbCr(r, image.YCbCrSubsampleRatio420)
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			c := color.YCbCrModel.Convert(img.At(x, y)).(color.YCbCr)
+			yuv.Y[yuv.YOffset(x, y)] = c.Y
+			if (x-r.Min.X)&1 == 0 && (y-r.Min.Y)&1 == 0 {
+				i := yuv.COffset(x, y)
+				yuv.Cb[i] = c.Cb
+				yuv.Cr[i] = c.Cr
+			}
+		}
+	}
+	return
+}
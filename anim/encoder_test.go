@@ -0,0 +1,55 @@
+package anim
+
+import (
+	"image"
+	"testing"
+
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
+)
+
+func TestIvfBridge(t *testing.T) {
+	b := newBridge()
+	go func() {
+		b.Write(ivfHeader(fourccVP8, 320, 240, 25))
+		b.Write(ivfFrame(0, []byte{1, 2, 3}))
+		b.Write(ivfFrame(1, []byte{4, 5}))
+		b.Close()
+	}()
+
+	r, hdr, err := ivfreader.NewWith(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(hdr.FourCC[:]) != fourccVP8 || hdr.Width != 320 || hdr.TimebaseDenominator != 25 || hdr.TimebaseNumerator != 1 {
+		t.Fatalf("unexpected header %+v", hdr)
+	}
+	for i, exp := range [][]byte{{1, 2, 3}, {4, 5}} {
+		frame, fh, err := r.ParseNextFrame()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(frame) != string(exp) || fh.Timestamp != uint64(i) {
+			t.Fatal("unexpected frame", i, frame, fh.Timestamp)
+		}
+	}
+	if _, _, err = r.ParseNextFrame(); err == nil {
+		t.Fatal("EOF expected")
+	}
+}
+
+func TestToI420(t *testing.T) {
+	rgba := image.NewRGBA(image.Rect(0, 0, 3, 3))
+	for i := range rgba.Pix {
+		rgba.Pix[i] = 0xff
+	}
+	yuv := toI420(rgba)
+	if yuv.SubsampleRatio != image.YCbCrSubsampleRatio420 || len(yuv.Cb) != 4 {
+		t.Fatal("unexpected layout", yuv.SubsampleRatio, len(yuv.Cb))
+	}
+	if yuv.Y[8] != 0xff || yuv.Cb[3] != 0x80 {
+		t.Fatal("unexpected colors", yuv.Y[8], yuv.Cb[3])
+	}
+	if toI420(yuv) != yuv {
+		t.Fatal("i420 is converted again")
+	}
+}
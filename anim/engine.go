@@ -2,11 +2,13 @@ package anim
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"image"
+	_ "image/png"
 	"io"
 	"log"
+	"math/rand"
 	"net"
 	"os"
 	"path"
@@ -16,34 +18,152 @@ import (
 
 	"github.com/dmisol/animportal/defs"
 	"github.com/dmisol/animportal/relay"
-	"github.com/gen2brain/x264-go"
+	"github.com/dmisol/animportal/tts"
+	"github.com/dmisol/animportal/wire"
 	lksdk "github.com/livekit/server-sdk-go"
 	"github.com/pion/webrtc/v3"
 )
 
-func NewEngine(ctx context.Context, addr string, ram string, room *lksdk.Room, conf defs.PortalConf) (e *Engine, err error) {
+func NewEngine(ctx context.Context, pool *Pool, ram string, room *lksdk.Room, conf defs.PortalConf) (e *Engine, err error) {
 	e = &Engine{
-		Room: room,
-		t0:   time.Now(),
+		Room:   room,
+		t0:     time.Now(),
+		jitter: conf.JitterDepth,
+		chunk:  conf.PcmChunk,
+		vad:    conf.Vad,
+		only:   conf.VisemeOnly,
+		vosk:   conf.Vosk,
 	}
-	e.Context, _ = context.WithCancel(ctx)
-	if e.animation, err = newAnimation(e.Context, addr, path.Join(ram, "pcm"), e.onEncodedVideo, conf.InitialJson); err != nil {
+	if conf.VisemeModel != "" {
+		// fail early on typos
+		if _, err = newVisemeModel(conf.VisemeModel); err != nil {
+			e = nil
+			return
+		}
+		e.model = conf.VisemeModel
+	}
+	e.clock = newMediaClock(e.t0)
+	e.Context, e.cancel = context.WithCancel(ctx)
+	if e.opus, err = webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{
+		MimeType:    webrtc.MimeTypeOpus,
+		ClockRate:   opusRate,
+		Channels:    2,
+		SDPFmtpLine: "minptime=10;useinbandfec=1",
+	}, "audio", "flexatar"); err != nil {
+		e.cancel()
+		e = nil
 		return
 	}
-
+	if conf.Tts != "" {
+		if e.tts, err = tts.New(conf.Tts); err != nil {
+			e.cancel()
+			e = nil
+			return
+		}
+	}
+	e.scripts = conf.ScriptDir
+	if e.tts != nil || e.scripts != "" {
+		if e.speech, err = newSpeechTrack(); err != nil {
+			e.cancel()
+			e = nil
+			return
+		}
+		e.say = make(chan *utterance, sayQueue)
+	}
+	conf.InitialJson.Inband = conf.Transport == defs.TransportInband
+	if e.animation, err = newAnimation(e.Context, pool, path.Join(ram, "pcm"), e.onVideo, conf.InitialJson); err != nil {
+		e.cancel()
+		e = nil
+		return
+	}
+	if e.speech != nil {
+		go e.speak()
+	}
+	if !conf.NoIdle {
+		go e.idle()
+	}
 	return
 }
 
 type Engine struct {
-	audio io.ReadCloser
+	mu    sync.Mutex
+	audio *AudioProc
+	opus  *webrtc.TrackLocalStaticRTP // owner's audio, delayed to match the flexatar
 	*animation
 
 	context.Context
+	cancel context.CancelFunc
 	*lksdk.Room
-	t0 time.Time
+	t0     time.Time
+	clock  *mediaClock   // owner's, synthesized and idle pcm share the media time
+	jitter int           // depth
+	chunk  time.Duration // pcm sent for animation at once
+	vad    bool          // silence is sent as Idle
+	model  string        // phones are sent if set
+	only   bool          // phones instead of pcm
+	vosk   string        // asr websocket url, words are sent if set
+	asr    *asr
+
+	tts    tts.Synth
+	speech *webrtc.TrackLocalStaticSample // synthesized, delayed to match the flexatar
+	say    chan *utterance
+
+	scripts string // audio files of scripts are there
+	playing int32
 
 	*relay.Relay
-	started int32
+	started    int32
+	muted      int32
+	idleChunks int64
+}
+
+// Stats is a snapshot of the engine state, for monitoring
+type Stats struct {
+	Started time.Time `json:"started"`
+	Server  string    `json:"server"` // animation server the session is placed at, if connected
+	Video   bool      `json:"video"`  // flexatar is published to the hall
+	Chunks  int64     `json:"chunks"` // pcm portions sent for animation
+
+	Latency    int64 `json:"latency_ms"`     // smoothed pcm -> frame round trip
+	AudioDelay int64 `json:"audio_delay_ms"` // applied to the relayed audio
+
+	Jitter  *JitterStats  `json:"jitter,omitempty"`  // owner's audio
+	Conceal *ConcealStats `json:"conceal,omitempty"` // owner's audio
+	Vad     *VadStats     `json:"vad,omitempty"`     // owner's audio
+
+	Idle       int64 `json:"idle"`       // chunks of silence made up while nothing was said
+	Fallback   bool  `json:"fallback"`   // the server is gone, placeholder is published
+	Reconnects int64 `json:"reconnects"` // to the server, after the connection was lost
+	Paused     bool  `json:"paused"`     // pcm is not sent, video is frozen
+	Muted      bool  `json:"muted"`      // no audio to the hall
+}
+
+func (e *Engine) Stats() (s Stats) {
+	s.Started = e.t0
+	s.Video = atomic.LoadInt32(&e.started) > 0
+	s.Chunks = atomic.LoadInt64(&e.animation.index)
+	s.Idle = atomic.LoadInt64(&e.idleChunks)
+	s.Paused = e.animation.isPaused()
+	s.Fallback = e.animation.fb.active()
+	s.Reconnects = atomic.LoadInt64(&e.animation.reconnects)
+	s.Server = e.animation.placed()
+	s.Muted = e.isMuted()
+
+	s.Latency = e.animation.lips.rtt().Milliseconds()
+	s.AudioDelay = e.animation.lips.Delay().Milliseconds()
+
+	e.mu.Lock()
+	a := e.audio
+	e.mu.Unlock()
+	if a != nil {
+		js := a.Stats()
+		s.Jitter = &js
+		cs := a.Concealed()
+		s.Conceal = &cs
+		vs := a.vad.Stats()
+		s.Vad = &vs
+	}
+	return
 }
 
 func (e *Engine) OnAuioTrack(remote *webrtc.TrackRemote) {
@@ -51,26 +171,98 @@ func (e *Engine) OnAuioTrack(remote *webrtc.TrackRemote) {
 
 	/* agreed on:
 	- files@ramdisk, name over tcp socket
-	- 16 bits, mono, 16kHz, 50 ms
+	- 16 bits, mono, 16kHz, 50 ms (see chunker)
 	- byte order to be verifier
 	- anim server removes useless files
 	- client removes folder @ ramdisk
 	*/
 	e.Println("start sending audio for animation")
 
-	e.audio = newAudioProc(remote, e.animation)
+	dest := e.pipeline()
+	var r *asr
+	if e.vosk != "" {
+		var err error
+		if r, err = newAsr(e.Context, dest, e.vosk); err != nil {
+			// animation goes on without
+			e.Println("vosk", err)
+		} else {
+			dest = r
+		}
+	}
+	a := newAudioProc(e.Context, remote, dest, e.jitter, e.chunk, e.clock, e.vad)
+	e.mu.Lock()
+	e.audio = a
+	e.asr = r
+	e.mu.Unlock()
+	go e.relayAudio(a)
 
 	go func() {
 		<-e.Context.Done()
 		e.Println("stop sending audio for animation")
 
-		e.audio.Close()
+		e.stopAudio()
 		e.animation.Close()
 	}()
 
 }
 
-func (e *Engine) onEncodedVideo() {
+// pipeline() is where chunks of pcm go for animation
+func (e *Engine) pipeline() (dest animWriter) {
+	dest = e.animation
+	if e.model != "" {
+		m, _ := newVisemeModel(e.model)
+		dest = newVisemes(e.animation, m, e.only)
+	}
+	return
+}
+
+// relayAudio() forwards owner's audio to the hall, delayed to keep lips in sync
+func (e *Engine) relayAudio(a *AudioProc) {
+	for {
+		p, err := a.next()
+		if err != nil {
+			e.Println("audio relay", err)
+			return
+		}
+		if d := time.Until(p.at.Add(e.animation.lips.Delay())); d > 0 {
+			select {
+			case <-e.Context.Done():
+				return
+			case <-time.After(d):
+			}
+		}
+		if e.isMuted() {
+			continue
+		}
+		if err = e.opus.WriteRTP(p.Packet); err != nil {
+			e.Println("audio relay", err)
+			return
+		}
+	}
+}
+
+// Close() stops the engine, even if no audio was ever received
+func (e *Engine) Close() {
+	e.cancel()
+	e.stopAudio()
+	e.animation.Close()
+}
+
+// stopAudio() lets the rest of pcm and recognition results go before the animation is closed
+func (e *Engine) stopAudio() {
+	e.mu.Lock()
+	a, r := e.audio, e.asr
+	e.mu.Unlock()
+	if a != nil {
+		a.Close()
+	}
+	if r != nil {
+		r.stop()
+	}
+}
+
+// onVideo() publishes the tracks, called before every frame is encoded
+func (e *Engine) onVideo() {
 	x := atomic.AddInt32(&e.started, 1)
 	if x != 1 {
 		return
@@ -80,83 +272,293 @@ func (e *Engine) onEncodedVideo() {
 		e.Println("newRelay", err)
 		return
 	}
-	e.Relay.AddReadCloser(e.audio, webrtc.MimeTypeOpus)
-	e.Relay.AddReadCloser(e.animation.bridge, webrtc.MimeTypeH264)
+	e.Relay.AddLocalTrack(e.opus)
+	if e.speech != nil {
+		e.Relay.AddLocalTrack(e.speech)
+	}
+	if e.animation.track != nil {
+		e.Relay.AddLocalTrack(e.animation.track)
+		return
+	}
+	e.Relay.AddReadCloser(e.animation.bridge, e.animation.mime)
 }
 
 func (e *Engine) Println(i ...interface{}) {
 	log.Println("anim.engine", i)
 }
 
-func newAnimation(ctx context.Context, addr string, dir string, f func(), conf defs.InitialJson) (p *animation, err error) {
-	// mkdir in ramfs
-	os.MkdirAll(dir, 0755)
+const (
+	dialTimeout  = 5 * time.Second
+	byeTimeout   = time.Second            // a stuck server does not hold the session teardown
+	reconnectMin = 500 * time.Millisecond // backoff, doubled per failed attempt
+	reconnectMax = 30 * time.Second
+)
+
+func newAnimation(ctx context.Context, pool *Pool, dir string, f func(), conf defs.InitialJson) (p *animation, err error) {
+	if !conf.Inband {
+		// mkdir in ramfs
+		os.MkdirAll(dir, 0755)
+	}
 
 	// create structure
-	p = &animation{dir: dir}
-	p.bridge = &bridge{}
-	opts := &x264.Options{
-		Width:     conf.W,
-		Height:    conf.H,
-		FrameRate: conf.FPS,
-		Tune:      "zerolatency",
-		Preset:    "veryfast",
-		Profile:   "baseline",
-		LogLevel:  x264.LogDebug,
+	p = &animation{pool: pool, conf: conf, dir: dir, inband: conf.Inband, onFrame: f, lips: newLipSync(conf.FPS), fb: newFallback(conf)}
+	// h264 is packetized here, VPx goes to relay as ivf
+	var out io.Writer
+	if conf.Codec == "" || conf.Codec == defs.CodecH264 {
+		if p.track, err = newH264Track(); err != nil {
+			return
+		}
+		out = newRtpH264(p.track, conf.FPS)
+	} else {
+		p.bridge = newBridge()
+		out = p.bridge
 	}
-	if p.enc, err = x264.NewEncoder(p.bridge, opts); err != nil {
+	if p.enc, p.mime, err = newEncoder(out, conf); err != nil {
 		return
 	}
+	defer func() {
+		if err != nil {
+			p.Close()
+			p = nil
+		}
+	}()
 
-	// connect to port
-	if p.conn, err = net.Dial("tcp", addr); err != nil {
+	if p.conn, p.srv, err = p.place(ctx); err != nil {
 		return
 	}
 
-	// send initial json
-	var b []byte
-	if b, err = json.Marshal(conf); err != nil {
+	// start reading images
+	go p.run(ctx)
+	return
+}
+
+// place() dials servers of the pool, least loaded first, till one takes the session
+func (p *animation) place(ctx context.Context) (conn *wire.Conn, s *server, err error) {
+	tried := make(map[*server]bool)
+	for ctx.Err() == nil {
+		var e error
+		if s, e = p.pool.acquire(tried); e != nil {
+			if err == nil {
+				err = e
+			}
+			return
+		}
+		tried[s] = true
+		if conn, err = p.dial(ctx, s.Addr); err == nil {
+			p.pool.mark(s, nil)
+			return
+		}
+		p.pool.release(s)
+		p.Println("placing", err)
+		if errors.Is(err, ErrConnect) {
+			p.pool.mark(s, err)
+		}
+		s = nil
+	}
+	if err == nil {
+		err = ctx.Err()
+	}
+	return
+}
+
+// dial() connects the server and replays the handshake: hello, initial json
+func (p *animation) dial(ctx context.Context, addr string) (conn *wire.Conn, err error) {
+	var c net.Conn
+	d := &net.Dialer{Timeout: dialTimeout}
+	if c, err = d.DialContext(ctx, "tcp", addr); err != nil {
+		err = fmt.Errorf("%w %s: %v", ErrConnect, addr, err)
+		return
+	}
+	conn = wire.NewConn(c)
+	defer func() {
+		if err != nil {
+			conn.Close()
+			conn = nil
+		}
+	}()
+
+	// negotiate protocol version, detects old servers
+	if err = conn.Hello(); err != nil {
 		return
 	}
-	if _, err = p.conn.Write(b); err != nil {
+	if p.inband && conn.Version < wire.InbandVersion {
+		err = fmt.Errorf("%w: %d, no in-band transport", wire.ErrVersion, conn.Version)
 		return
 	}
 
-	// start reading images
-	go func() {
-		defer p.conn.Close()
+	// send initial json
+	err = conn.SendJson(wire.Init, p.conf)
+	return
+}
+
+// run() reads frames, and reconnects till ctx is over
+func (p *animation) run(ctx context.Context) {
+	for {
+		conn := p.current()
+		p.read(ctx, conn)
+		conn.Close()
+		p.connMu.Lock()
+		closed := p.closed
+		p.connMu.Unlock()
+		if closed || ctx.Err() != nil {
+			return
+		}
+
+		// the hall is not to see a frozen flexatar
+		atomic.StoreInt32(&p.down, 1)
+		p.fb.start(p)
+		if !p.reconnect(ctx) {
+			return
+		}
+	}
+}
 
-		for {
+// reconnect() dials with exponential backoff; pcm numbering, encoder and track are kept
+func (p *animation) reconnect(ctx context.Context) bool {
+	backoff := reconnectMin
+	for {
+		// jitter, not to have all the sessions back at once
+		wait := backoff - time.Duration(rand.Int63n(int64(backoff/4)))
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(wait):
+		}
+
+		// the session may go to another server
+		p.connMu.Lock()
+		prev := p.srv
+		p.srv = nil
+		p.connMu.Unlock()
+		p.pool.release(prev)
+
+		conn, s, err := p.place(ctx)
+		if err != nil {
+			p.Println("reconnect", err)
+			if backoff *= 2; backoff > reconnectMax {
+				backoff = reconnectMax
+			}
+			continue
+		}
+
+		// controls applied so far are replayed, the ones coming meanwhile wait for the lock
+		p.connMu.Lock()
+		closed := p.closed
+		if !closed {
+			p.conn, p.srv = conn, s
+			if !p.ctl.Empty() && conn.Version >= wire.ControlVersion {
+				if err = conn.SendJson(wire.Control, &p.ctl); err != nil {
+					p.Println("control replay", err)
+				}
+			}
+			atomic.StoreInt32(&p.down, 0)
+		}
+		p.connMu.Unlock()
+		if closed {
+			conn.Close()
+			p.pool.release(s)
+			return false
+		}
+
+		// the server counts frames from scratch
+		p.lips.reset()
+		n := atomic.AddInt64(&p.reconnects, 1)
+		p.Println("reconnected", n, "times to", s.Addr, "chunks resume at", atomic.LoadInt64(&p.index)+1)
+		return true
+	}
+}
+
+// placed() is the address of the server the session is at
+func (p *animation) placed() string {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+
+	if p.srv == nil {
+		return ""
+	}
+	return p.srv.Addr
+}
+
+// current() is the connection to the server
+func (p *animation) current() *wire.Conn {
+	p.connMu.Lock()
+	defer p.connMu.Unlock()
+
+	return p.conn
+}
+
+// read() encodes frames from the server till the connection is over
+func (p *animation) read(ctx context.Context, conn *wire.Conn) {
+	for {
+		m, err := conn.Recv()
+		if err != nil {
 			select {
 			case <-ctx.Done():
-				p.Println("killex (ctx)")
-				return
+				p.Println("killed (ctx)")
 			default:
-				b := make([]byte, 1024)
-				i, err := p.conn.Read(b)
-				if err != nil {
-					p.Println("sock rd", err)
-					return
-				}
-				name := string(b[:i])
-				if err = p.procImage(name); err != nil {
-					p.Println("h264 encoding", err)
-					return
-				}
+				p.Println("sock rd", err)
 			}
+			return
 		}
-	}()
-	return
+		if p.isPaused() && (m.Type == wire.Frame || m.Type == wire.Image) {
+			// the last frame stays
+			continue
+		}
+		switch m.Type {
+		case wire.Frame:
+			p.fb.halt()
+			// the track is published before the first frame is encoded, sps/pps and idr are not lost
+			p.onFrame()
+			if err = p.procImage(string(m.Payload)); err != nil {
+				p.Println("h264 encoding", err)
+				return
+			}
+			p.lips.onFrame()
+		case wire.Image:
+			p.fb.halt()
+			p.onFrame()
+			if err = p.procInband(m.Payload); err != nil {
+				p.Println("h264 encoding", err)
+				return
+			}
+			p.lips.onFrame()
+		case wire.Error:
+			p.Println("server error:", string(m.Payload))
+		case wire.Bye:
+			p.Println("server closed session")
+			return
+		default:
+			p.Println("unexpected", m.Type)
+		}
+	}
 }
 
 type animation struct {
-	conn net.Conn
-	dir  string
-
-	index int64
-
-	enc *x264.Encoder
+	pool   *Pool
+	conf   defs.InitialJson
+	connMu sync.Mutex
+	conn   *wire.Conn   // replaced on reconnection
+	srv    *server      // the conn is to
+	ctl    defs.Control // applied so far, replayed on reconnection
+	closed bool
+	dir    string
+	inband bool
+	once   sync.Once
+
+	index      int64 // pcm chunks, numbering goes on across reconnections
+	reconnects int64
+	down       int32 // connection is lost, reconnecting
+	paused     int32
+	last       int64 // unix ns, when pcm was sent
+
+	encMu sync.Mutex // server frames and placeholder
+	enc   Encoder
+	mime  string
+	track *webrtc.TrackLocalStaticRTP
 	*bridge
+	onFrame func()
+	lips    *lipSync
+	fb      *fallback
 }
 
 func (p *animation) procImage(name string) (err error) {
@@ -164,32 +566,126 @@ func (p *animation) procImage(name string) (err error) {
 	if r, err = os.Open(name); err != nil {
 		return
 	}
+	defer r.Close()
 
 	var img image.Image
 	if img, _, err = image.Decode(r); err != nil {
 		return
 	}
-	// conv data to h264 and Write() to *bridge
-	err = p.enc.Encode(img)
+	// compress and Write() to rtp track or *bridge
+	err = p.encode(img)
+	return
+}
+
+func (p *animation) procInband(payload []byte) (err error) {
+	var img image.Image
+	if img, err = wire.DecodeImage(payload); err != nil {
+		return
+	}
+	err = p.encode(img)
 	return
 }
 
-// Write() will be called when PCM portion is ready to be sent for animation computing
-func (p *animation) Write(pcm []byte) (i int, err error) {
+func (p *animation) encode(img image.Image) error {
+	p.encMu.Lock()
+	defer p.encMu.Unlock()
+
+	return p.enc.Encode(img)
+}
+
+// WriteChunk() will be called when PCM portion is ready to be sent for animation computing
+func (p *animation) WriteChunk(media time.Duration, pcm []byte) (err error) {
+	if p.dropping() {
+		return
+	}
+	conn := p.current()
+	stamped := conn.Version >= wire.StampVersion
+	if p.inband {
+		atomic.AddInt64(&p.index, 1)
+		payload := pcm
+		if stamped {
+			payload = wire.EncodeChunk(media, pcm)
+		}
+		if err = conn.Send(wire.Pcm, payload); err == nil {
+			p.sent(len(pcm))
+		}
+		return
+	}
+
 	// create file
 	name := fmt.Sprintf("%s/%d.pcm", p.dir, atomic.AddInt64(&p.index, 1))
 	if err = os.WriteFile(name, pcm, 0666); err != nil {
 		return
 	}
-	i = len(pcm)
-
+	payload := []byte(name)
+	if stamped {
+		payload = wire.EncodeChunk(media, payload)
+	}
 	// send name to socket
-	_, err = p.conn.Write([]byte(name))
+	if err = conn.Send(wire.Audio, payload); err == nil {
+		p.sent(len(pcm))
+	}
+	return
+}
+
+// WriteIdle() replaces silent pcm with Idle, old servers get pcm anyway
+func (p *animation) WriteIdle(media time.Duration, pcm []byte) (err error) {
+	if p.dropping() {
+		return
+	}
+	conn := p.current()
+	if conn.Version < wire.IdleVersion {
+		return p.WriteChunk(media, pcm)
+	}
+	d := time.Duration(len(pcm)/pcmBytesPerMs) * time.Millisecond
+	if err = conn.Send(wire.Idle, wire.EncodeIdle(media, d)); err == nil {
+		p.sent(len(pcm))
+	}
+	return
+}
+
+// WriteAnim() sends phones; pcm, if any, is the chunk they replace
+func (p *animation) WriteAnim(a *defs.Anim, pcm []byte) (err error) {
+	if p.dropping() {
+		return
+	}
+	conn := p.current()
+	if conn.Version < wire.AnimVersion {
+		return fmt.Errorf("%w: %d, no phones", wire.ErrVersion, conn.Version)
+	}
+	if err = conn.SendJson(wire.Anim, a); err == nil && len(pcm) > 0 {
+		p.sent(len(pcm))
+	}
 	return
 }
 
+// sent() accounts pcm sent, in any form
+func (p *animation) sent(bytes int) {
+	atomic.StoreInt64(&p.last, time.Now().UnixNano())
+	p.lips.onChunk(bytes)
+}
+
 func (p *animation) Close() (err error) {
-	p.enc.Close()
+	p.once.Do(func() {
+		p.connMu.Lock()
+		p.closed = true
+		conn, s := p.conn, p.srv
+		p.srv = nil
+		p.connMu.Unlock()
+		if conn != nil {
+			conn.SetWriteDeadline(time.Now().Add(byeTimeout))
+			conn.Send(wire.Bye, nil)
+			conn.Close()
+		}
+		p.pool.release(s)
+		p.fb.close()
+		p.encMu.Lock()
+		err = p.enc.Close()
+		p.encMu.Unlock()
+		if p.bridge != nil {
+			p.bridge.Close()
+		}
+	})
 	return
 }
 
@@ -198,15 +694,22 @@ func (p *animation) Println(i ...interface{}) {
 }
 
 // converts Writer to ReadCloser
-// x264enc -> bridge -> relay
+// encoder -> bridge -> relay
 type bridge struct {
-	// todo: convert to RFC 6184 ?
-	mu   sync.Mutex
-	data [][]byte
+	mu     sync.Mutex
+	cond   *sync.Cond
+	data   [][]byte
+	closed bool
 
 	remained []byte
 }
 
+func newBridge() (b *bridge) {
+	b = &bridge{}
+	b.cond = sync.NewCond(&b.mu)
+	return
+}
+
 func (b *bridge) Write(p []byte) (i int, err error) {
 	i = len(p)
 
@@ -214,29 +717,38 @@ func (b *bridge) Write(p []byte) (i int, err error) {
 	defer b.mu.Unlock()
 
 	b.data = append(b.data, p)
+	b.cond.Signal()
 	return
 }
 
+// Read() blocks till data is available or bridge is closed
 func (b *bridge) Read(p []byte) (i int, err error) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	if len(b.remained) > 0 {
-		i = copy(p, b.remained)
-		b.remained = b.remained[:i]
-		return
+	for len(b.remained) == 0 && len(b.data) == 0 && !b.closed {
+		b.cond.Wait()
 	}
 
-	if len(b.data) == 0 {
-		return
+	if len(b.remained) == 0 {
+		if len(b.data) == 0 {
+			err = io.EOF
+			return
+		}
+		b.remained = b.data[0]
+		b.data = b.data[1:]
 	}
 
-	b.remained = b.data[0]
-	b.data = b.data[1:]
-
 	i = copy(p, b.remained)
-	b.remained = b.remained[:i]
+	b.remained = b.remained[i:]
 	return
 }
 
-func (b *bridge) Close() (err error) { return }
+func (b *bridge) Close() (err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	b.cond.Broadcast()
+	return
+}
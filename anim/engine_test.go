@@ -0,0 +1,151 @@
+package anim
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmisol/animportal/defs"
+	"github.com/dmisol/animportal/wire"
+)
+
+// session() accepts the portal, returns the initial json
+func session(t *testing.T, l net.Listener) (conn *wire.Conn, init *defs.InitialJson) {
+	c, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn = wire.NewConn(c)
+	if err = conn.Accept(); err != nil {
+		t.Fatal(err)
+	}
+	m, err := conn.Recv()
+	if err != nil || m.Type != wire.Init {
+		t.Fatal("init expected", err)
+	}
+	init = &defs.InitialJson{}
+	if err = json.Unmarshal(m.Payload, init); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func recv(t *testing.T, conn *wire.Conn, typ wire.Type) *wire.Msg {
+	m, err := conn.Recv()
+	if err != nil || m.Type != typ {
+		t.Fatal(typ, "expected", m, err)
+	}
+	return m
+}
+
+func TestReconnect(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	conf := defs.InitialJson{W: 8, H: 6, FPS: 50, Inband: true, Ftar: "a.ftar"}
+	p := &animation{pool: NewPool(defs.PortalConf{AnimAddr: l.Addr().String()}), conf: conf, inband: true, enc: &countingEncoder{},
+		onFrame: func() {}, lips: newLipSync(conf.FPS), fb: newFallback(conf)}
+	defer p.Close()
+
+	dialed := make(chan error, 1)
+	go func() {
+		var err error
+		p.conn, p.srv, err = p.place(ctx)
+		dialed <- err
+	}()
+	srv, _ := session(t, l)
+	if err = <-dialed; err != nil {
+		t.Fatal(err)
+	}
+	go p.run(ctx)
+
+	go p.WriteChunk(0, make([]byte, 1600))
+	recv(t, srv, wire.Pcm)
+	pi := 3
+	go p.control(&defs.Control{Pi: &pi})
+	recv(t, srv, wire.Control)
+
+	// network blip
+	srv.Close()
+	for i := 0; atomic.LoadInt32(&p.down) == 0; i++ {
+		if i > 100 {
+			t.Fatal("not down")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	// kept while reconnecting
+	hat := true
+	if err = p.control(&defs.Control{Hat: &hat}); err != nil {
+		t.Fatal(err)
+	}
+	srv, init := session(t, l)
+	defer srv.Close()
+	if init.Ftar != "a.ftar" || !init.Inband {
+		t.Fatal("unexpected init", init)
+	}
+	c := &defs.Control{}
+	if json.Unmarshal(recv(t, srv, wire.Control).Payload, c) != nil || c.Pi == nil || *c.Pi != 3 || c.Hat == nil {
+		t.Fatal("control is not replayed")
+	}
+
+	for i := 0; atomic.LoadInt32(&p.down) > 0; i++ {
+		if i > 100 {
+			t.Fatal("still down")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !p.fb.active() {
+		t.Fatal("no placeholder")
+	}
+	go p.WriteChunk(50*time.Millisecond, make([]byte, 1600))
+	recv(t, srv, wire.Pcm)
+	if atomic.LoadInt64(&p.index) != 2 || atomic.LoadInt64(&p.reconnects) != 1 {
+		t.Fatal("unexpected numbering", p.index, p.reconnects)
+	}
+	if st := p.pool.Stats(); st[0].Sessions != 1 || p.placed() != l.Addr().String() {
+		t.Fatal("unexpected placement", st, p.placed())
+	}
+
+	// the first frame replaces the placeholder
+	buf := &bytes.Buffer{}
+	png.Encode(buf, image.NewRGBA(image.Rect(0, 0, 8, 6)))
+	if err = srv.Send(wire.Image, wire.EncodeImage(wire.PNG, 8, 6, buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; p.fb.active(); i++ {
+		if i > 100 {
+			t.Fatal("placeholder is not halted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestCloseStuck(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c2.Close()
+
+	// nobody reads, Bye would block
+	p := &animation{conn: wire.NewConn(c1), enc: &countingEncoder{}, fb: newFallback(defs.InitialJson{})}
+	done := make(chan struct{})
+	go func() {
+		p.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(2 * byeTimeout):
+		t.Fatal("Close() is stuck")
+	}
+}
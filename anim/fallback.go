@@ -0,0 +1,203 @@
+package anim
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dmisol/animportal/defs"
+)
+
+const (
+	cardText = "RECONNECTING"
+	cardDots = 4 // states of the "..." animation, 1 per second
+)
+
+// fallback publishes a placeholder through the same encoder while the server is gone:
+// InitialJson.Static image, or a generated card
+type fallback struct {
+	mu     sync.Mutex
+	stop   chan struct{}
+	done   chan struct{}
+	closed bool
+
+	fps    int
+	frames []image.Image // static, or card per dots state
+}
+
+func newFallback(conf defs.InitialJson) (f *fallback) {
+	w, h, fps := conf.W, conf.H, conf.FPS
+	if w <= 0 || h <= 0 {
+		w, h = 640, 480
+	}
+	if fps <= 0 {
+		fps = 24
+	}
+	f = &fallback{fps: fps}
+
+	if conf.Static != "" {
+		img, err := loadImage(conf.Static)
+		if err == nil {
+			f.frames = []image.Image{fit(img, w, h)}
+			return
+		}
+		f.Println("static", err)
+	}
+	for i := 0; i < cardDots; i++ {
+		f.frames = append(f.frames, card(w, h, i))
+	}
+	return
+}
+
+// start() runs the placeholder, if not yet
+func (f *fallback) start(p *animation) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.stop != nil || f.closed {
+		return
+	}
+	f.Println("server is gone, placeholder video")
+	f.stop = make(chan struct{})
+	f.done = make(chan struct{})
+	go f.run(p, f.stop, f.done)
+}
+
+// halt() stops the placeholder and waits till it is over
+func (f *fallback) halt() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.haltLocked()
+}
+
+// close() stops the placeholder for good
+func (f *fallback) close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.closed = true
+	f.haltLocked()
+}
+
+func (f *fallback) haltLocked() {
+	if f.stop == nil {
+		return
+	}
+	close(f.stop)
+	<-f.done
+	f.stop, f.done = nil, nil
+	f.Println("placeholder stopped")
+}
+
+func (f *fallback) active() bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.stop != nil
+}
+
+func (f *fallback) run(p *animation, stop chan struct{}, done chan struct{}) {
+	defer close(done)
+
+	t := time.NewTicker(time.Second / time.Duration(f.fps))
+	defer t.Stop()
+	for i := 0; ; i++ {
+		select {
+		case <-stop:
+			return
+		case <-t.C:
+		}
+		img := f.frames[(i/f.fps)%len(f.frames)]
+		p.onFrame()
+		if err := p.encode(img); err != nil {
+			f.Println("encoding", err)
+			return
+		}
+	}
+}
+
+func (f *fallback) Println(i ...interface{}) {
+	log.Println("anim.fallback", i)
+}
+
+func loadImage(name string) (img image.Image, err error) {
+	var r *os.File
+	if r, err = os.Open(name); err != nil {
+		return
+	}
+	defer r.Close()
+
+	img, _, err = image.Decode(r)
+	return
+}
+
+// fit() scales the image to w x h, nearest neighbour
+func fit(img image.Image, w int, h int) image.Image {
+	b := img.Bounds()
+	if b.Dx() == w && b.Dy() == h {
+		return img
+	}
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			out.Set(x, y, img.At(b.Min.X+x*b.Dx()/w, b.Min.Y+y*b.Dy()/h))
+		}
+	}
+	return out
+}
+
+// 5x7 glyphs, enough for the card
+var glyphs = map[rune][7]uint8{
+	'R': {0x1e, 0x11, 0x11, 0x1e, 0x14, 0x12, 0x11},
+	'E': {0x1f, 0x10, 0x10, 0x1e, 0x10, 0x10, 0x1f},
+	'C': {0x0e, 0x11, 0x10, 0x10, 0x10, 0x11, 0x0e},
+	'O': {0x0e, 0x11, 0x11, 0x11, 0x11, 0x11, 0x0e},
+	'N': {0x11, 0x19, 0x15, 0x13, 0x11, 0x11, 0x11},
+	'T': {0x1f, 0x04, 0x04, 0x04, 0x04, 0x04, 0x04},
+	'I': {0x0e, 0x04, 0x04, 0x04, 0x04, 0x04, 0x0e},
+	'G': {0x0e, 0x11, 0x10, 0x17, 0x11, 0x11, 0x0f},
+	'.': {0x00, 0x00, 0x00, 0x00, 0x00, 0x0c, 0x0c},
+}
+
+// card() draws "RECONNECTING" with 0..3 dots, centered
+func card(w int, h int, dots int) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), &image.Uniform{color.RGBA{32, 32, 40, 255}}, image.Point{}, draw.Src)
+
+	text := cardText
+	for i := 0; i < dots; i++ {
+		text += "."
+	}
+	// 6 columns per glyph, width for 3 dots is reserved to keep the text still
+	cols := 6*(len(cardText)+cardDots-1) - 1
+	scale := w * 6 / 10 / cols
+	if scale < 1 {
+		scale = 1
+	}
+	x0 := (w - cols*scale) / 2
+	y0 := (h - 7*scale) / 2
+
+	fg := &image.Uniform{color.RGBA{220, 220, 220, 255}}
+	for i, r := range text {
+		g := glyphs[r]
+		for row := 0; row < 7; row++ {
+			for col := 0; col < 5; col++ {
+				if g[row]&(0x10>>col) == 0 {
+					continue
+				}
+				x := x0 + (6*i+col)*scale
+				y := y0 + row*scale
+				draw.Draw(img, image.Rect(x, y, x+scale, y+scale), fg, image.Point{}, draw.Src)
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,91 @@
+package anim
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmisol/animportal/defs"
+)
+
+type countingEncoder struct {
+	frames int32
+	w, h   int
+}
+
+func (c *countingEncoder) Encode(img image.Image) error {
+	atomic.AddInt32(&c.frames, 1)
+	c.w, c.h = img.Bounds().Dx(), img.Bounds().Dy()
+	return nil
+}
+
+func (c *countingEncoder) Close() error { return nil }
+
+func TestCard(t *testing.T) {
+	img := card(320, 240, 0)
+	bright := 0
+	b := img.Bounds()
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r > 0x8000 {
+				bright++
+			}
+		}
+	}
+	if bright == 0 {
+		t.Fatal("no text")
+	}
+	if r, _, _, _ := img.At(0, 0).RGBA(); r > 0x8000 {
+		t.Fatal("no background")
+	}
+}
+
+func TestFallback(t *testing.T) {
+	name := path.Join(t.TempDir(), "static.png")
+	f, _ := os.Create(name)
+	src := image.NewRGBA(image.Rect(0, 0, 2, 2))
+	src.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	png.Encode(f, src)
+	f.Close()
+
+	fb := newFallback(defs.InitialJson{W: 8, H: 6, FPS: 50, Static: name})
+	if len(fb.frames) != 1 || fb.frames[0].Bounds().Dx() != 8 {
+		t.Fatal("static is not used")
+	}
+	if r, _, _, _ := fb.frames[0].At(3, 2).RGBA(); r != 0xffff {
+		t.Fatal("static is not scaled")
+	}
+	if fb = newFallback(defs.InitialJson{Static: "nope.png"}); len(fb.frames) != cardDots {
+		t.Fatal("card is not used")
+	}
+
+	enc := &countingEncoder{}
+	var published int32
+	p := &animation{enc: enc, onFrame: func() { atomic.AddInt32(&published, 1) }, fb: newFallback(defs.InitialJson{W: 8, H: 6, FPS: 50})}
+	p.fb.start(p)
+	p.fb.start(p) // once
+	time.Sleep(100 * time.Millisecond)
+	if !p.fb.active() {
+		t.Fatal("not active")
+	}
+	p.fb.halt()
+	n := atomic.LoadInt32(&enc.frames)
+	if n < 2 || atomic.LoadInt32(&published) != n || enc.w != 8 {
+		t.Fatal("unexpected frames", n, published, enc.w)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if atomic.LoadInt32(&enc.frames) != n || p.fb.active() {
+		t.Fatal("not halted")
+	}
+
+	p.fb.close()
+	p.fb.start(p)
+	if p.fb.active() {
+		t.Fatal("started after close")
+	}
+}
@@ -0,0 +1,44 @@
+package anim
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// idle() keeps the frame clock going: when no pcm was sent for a while,
+// silence is sent, so the server animates blinks, breathing etc, the video is live
+// it is Idle for servers supporting it, or silent pcm otherwise
+func (e *Engine) idle() {
+	d := e.chunk
+	if d <= 0 {
+		d = defChunk
+	}
+	silence := make([]byte, int(d.Milliseconds())*pcmBytesPerMs)
+
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-e.Context.Done():
+			return
+		case <-t.C:
+		}
+		if !e.animation.quiet(d * 3 / 2) {
+			continue
+		}
+		if err := e.animation.WriteIdle(e.clock.stamp(d), silence); err != nil {
+			e.Println("idle", err)
+			continue
+		}
+		atomic.AddInt64(&e.idleChunks, 1)
+	}
+}
+
+// quiet() tells that nothing was sent for d, except being paused
+func (p *animation) quiet(d time.Duration) bool {
+	if p.dropping() {
+		return false
+	}
+	last := atomic.LoadInt64(&p.last)
+	return time.Since(time.Unix(0, last)) >= d
+}
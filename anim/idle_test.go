@@ -0,0 +1,83 @@
+package anim
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dmisol/animportal/wire"
+)
+
+func TestIdle(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	e := &Engine{
+		animation: &animation{conn: wire.NewConn(c1), inband: true, lips: newLipSync(20)},
+		chunk:     20 * time.Millisecond,
+		clock:     &mediaClock{t0: time.Now(), next: time.Second},
+	}
+	e.animation.conn.Version = wire.Version
+	e.Context, e.cancel = context.WithCancel(context.Background())
+	defer e.cancel()
+
+	// just sent, not quiet
+	e.animation.sent(0)
+	if e.animation.quiet(time.Second) {
+		t.Fatal("quiet after pcm")
+	}
+
+	go e.idle()
+	c2.SetReadDeadline(time.Now().Add(time.Second))
+	var last time.Duration
+	for i := 0; i < 3; i++ {
+		m, err := wire.Read(c2)
+		if err != nil || m.Type != wire.Idle {
+			t.Fatal("idle expected", err)
+		}
+		media, d, err := wire.DecodeIdle(m.Payload)
+		if err != nil || d != 20*time.Millisecond {
+			t.Fatal("unexpected idle", d, err)
+		}
+		// the media clock, not the wall clock
+		if i == 0 && media != time.Second || i > 0 && media != last+d {
+			t.Fatal("unexpected stamp", i, media)
+		}
+		last = media
+	}
+	// the 3rd is read, the first 2 are counted
+	if atomic.LoadInt64(&e.idleChunks) < 2 {
+		t.Fatal("idle chunks not counted")
+	}
+	e.cancel()
+
+	e.Pause(true)
+	if e.animation.quiet(0) {
+		t.Fatal("quiet while paused")
+	}
+}
+
+func TestIdleOldServer(t *testing.T) {
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+
+	e := &Engine{
+		animation: &animation{conn: wire.NewConn(c1), inband: true, lips: newLipSync(20)},
+		chunk:     20 * time.Millisecond,
+		clock:     newMediaClock(time.Now()),
+	}
+	// set before idle() reads it
+	e.animation.conn.Version = wire.IdleVersion - 1
+	e.Context, e.cancel = context.WithCancel(context.Background())
+	defer e.cancel()
+
+	go e.idle()
+	c2.SetReadDeadline(time.Now().Add(time.Second))
+	if m, err := wire.Read(c2); err != nil || m.Type != wire.Pcm || len(m.Payload) != 4+640 {
+		t.Fatal("silent pcm expected", err)
+	}
+}
@@ -0,0 +1,194 @@
+package anim
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defJitterDepth = 50 // packets, 1s of 20 ms opus
+	jitterWait     = 60 * time.Millisecond
+	maxSkipped     = 256
+)
+
+var (
+	ErrClosed = errors.New("Closed")
+)
+
+// JitterStats are counted by jitterBuffer
+type JitterStats struct {
+	Received  int64 `json:"received"`
+	Reordered int64 `json:"reordered"` // came out of order, but in time
+	Late      int64 `json:"late"`      // came after being skipped as lost
+	Lost      int64 `json:"lost"`      // skipped, never came in time
+	Duplicate int64 `json:"duplicate"`
+	Dropped   int64 `json:"dropped"` // buffer overflow, not counted as lost
+}
+
+// jitterBuffer orders rtp packets by sequence number
+// a reader waits for a missing packet not longer than jitterWait
+type jitterBuffer struct {
+	mu     sync.Mutex
+	notify chan struct{}
+	depth  int
+	pkts   []*audioPacket // sorted by seq
+
+	started bool
+	next    uint16 // to be read
+	highest uint16 // received
+	skipped map[uint16]bool
+	closed  bool
+
+	stats JitterStats
+}
+
+func newJitterBuffer(depth int) *jitterBuffer {
+	if depth <= 0 {
+		depth = defJitterDepth
+	}
+	return &jitterBuffer{
+		notify:  make(chan struct{}, 1),
+		depth:   depth,
+		skipped: make(map[uint16]bool),
+	}
+}
+
+// before() compares sequence numbers with wrap around
+func before(a uint16, b uint16) bool {
+	return int16(a-b) < 0
+}
+
+func (j *jitterBuffer) Push(p *audioPacket) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	seq := p.SequenceNumber
+	j.stats.Received++
+
+	if !j.started {
+		j.started = true
+		j.next = seq
+		j.highest = seq
+	}
+	if before(seq, j.next) {
+		if j.skipped[seq] {
+			delete(j.skipped, seq)
+			j.stats.Late++
+		} else {
+			j.stats.Duplicate++
+		}
+		return
+	}
+	if before(seq, j.highest) {
+		j.stats.Reordered++
+	} else {
+		j.highest = seq
+	}
+
+	// insert, keeping order; usually appended
+	i := len(j.pkts)
+	for i > 0 && before(seq, j.pkts[i-1].SequenceNumber) {
+		i--
+	}
+	if i > 0 && j.pkts[i-1].SequenceNumber == seq {
+		j.stats.Duplicate++
+		return
+	}
+	j.pkts = append(j.pkts, nil)
+	copy(j.pkts[i+1:], j.pkts[i:])
+	j.pkts[i] = p
+
+	if len(j.pkts) > j.depth {
+		// overflow, the oldest goes; the missing ones before it are lost
+		head := j.pkts[0].SequenceNumber
+		j.skip(head)
+		j.next = head + 1
+		j.pkts = j.pkts[1:]
+		j.stats.Dropped++
+	}
+
+	select {
+	case j.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Pop() blocks till the next packet is available
+// if a packet is missing, waits for it up to jitterWait since the next one arrived
+func (j *jitterBuffer) Pop(ctx context.Context) (p *audioPacket, err error) {
+	for {
+		var wait time.Duration
+		func() {
+			j.mu.Lock()
+			defer j.mu.Unlock()
+
+			if j.closed {
+				err = ErrClosed
+				return
+			}
+			if len(j.pkts) == 0 {
+				return
+			}
+			head := j.pkts[0]
+			if head.SequenceNumber != j.next {
+				if wait = jitterWait - time.Since(head.at); wait > 0 {
+					return
+				}
+				wait = 0
+				j.skip(head.SequenceNumber)
+			}
+			p = head
+			j.pkts = j.pkts[1:]
+			j.next = head.SequenceNumber + 1
+		}()
+		if p != nil || err != nil {
+			return
+		}
+
+		var expired <-chan time.Time
+		if wait > 0 {
+			expired = time.After(wait)
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			return
+		case <-j.notify:
+		case <-expired:
+		}
+	}
+}
+
+// skip() declares packets before seq as lost
+func (j *jitterBuffer) skip(seq uint16) {
+	for s := j.next; before(s, seq); s++ {
+		j.stats.Lost++
+		if len(j.skipped) < maxSkipped {
+			j.skipped[s] = true
+		}
+	}
+	if len(j.skipped) >= maxSkipped {
+		j.skipped = make(map[uint16]bool)
+	}
+	j.next = seq
+}
+
+func (j *jitterBuffer) Close() {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.closed = true
+	select {
+	case j.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (j *jitterBuffer) Stats() JitterStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.stats
+}
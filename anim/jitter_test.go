@@ -0,0 +1,102 @@
+package anim
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pion/rtp"
+)
+
+func pkt(seq uint16) *audioPacket {
+	return &audioPacket{Packet: &rtp.Packet{Header: rtp.Header{SequenceNumber: seq}}, at: time.Now()}
+}
+
+func TestJitterOrder(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	j := newJitterBuffer(10)
+	for _, s := range []uint16{65534, 0, 65535, 0, 1} {
+		j.Push(pkt(s))
+	}
+	for _, exp := range []uint16{65534, 65535, 0, 1} {
+		p, err := j.Pop(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.SequenceNumber != exp {
+			t.Fatal("expected", exp, "got", p.SequenceNumber)
+		}
+	}
+	if s := j.Stats(); s.Received != 5 || s.Reordered != 1 || s.Duplicate != 1 || s.Lost != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestJitterLoss(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	j := newJitterBuffer(10)
+	j.Push(pkt(10))
+	j.Pop(ctx)
+
+	// 11 is missing, 12 is held for jitterWait
+	t0 := time.Now()
+	j.Push(pkt(12))
+	p, err := j.Pop(ctx)
+	if err != nil || p.SequenceNumber != 12 {
+		t.Fatal("unexpected", p, err)
+	}
+	if dt := time.Since(t0); dt < jitterWait/2 {
+		t.Fatal("missing packet is not waited for", dt)
+	}
+
+	j.Push(pkt(11))
+	if s := j.Stats(); s.Lost != 1 || s.Late != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+func TestJitterBounded(t *testing.T) {
+	j := newJitterBuffer(3)
+	for s := uint16(0); s < 5; s++ {
+		j.Push(pkt(s))
+	}
+	if len(j.pkts) != 3 || j.pkts[0].SequenceNumber != 2 {
+		t.Fatal("unexpected buffer", len(j.pkts))
+	}
+	if s := j.Stats(); s.Dropped != 2 || s.Lost != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	// 5 is missing, lost; 6 is dropped, once
+	for s := uint16(6); s < 10; s++ {
+		j.Push(pkt(s))
+	}
+	if s := j.Stats(); s.Dropped != 6 || s.Lost != 1 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	if j.Push(pkt(6)); j.Stats().Duplicate != 1 {
+		t.Fatal("dropped is not duplicate")
+	}
+}
+
+func TestJitterCancel(t *testing.T) {
+	j := newJitterBuffer(3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := j.Pop(ctx); err != context.Canceled {
+		t.Fatal("expected cancel, got", err)
+	}
+
+	j.Close()
+	if _, err := j.Pop(context.Background()); err != ErrClosed {
+		t.Fatal("expected ErrClosed, got", err)
+	}
+}
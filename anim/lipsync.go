@@ -0,0 +1,106 @@
+package anim
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	pcmBytesPerMs = voskRate * 2 / 1000 // 16 bits, mono
+
+	maxLipDelay  = time.Second
+	rttSmooth    = 8 // srtt += (rtt - srtt)/rttSmooth
+	maxLipChunks = 1000
+)
+
+type chunkStamp struct {
+	media int64 // ms of audio, including the chunk
+	sent  time.Time
+}
+
+// lipSync estimates how late frames are with respect to the audio they are computed from
+// frame i is assumed to be ready when audio up to i/fps is processed
+type lipSync struct {
+	mu     sync.Mutex
+	fps    int64
+	bytes  int64 // pcm sent
+	chunks []chunkStamp
+	frames int64
+
+	srtt time.Duration
+}
+
+func newLipSync(fps int) *lipSync {
+	if fps <= 0 {
+		fps = 24
+	}
+	return &lipSync{fps: int64(fps)}
+}
+
+// onChunk() is called when pcm portion is sent for animation
+func (l *lipSync) onChunk(bytes int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.bytes += int64(bytes)
+	l.chunks = append(l.chunks, chunkStamp{media: l.bytes / pcmBytesPerMs, sent: time.Now()})
+	if len(l.chunks) > maxLipChunks {
+		// frames do not come back
+		l.chunks = l.chunks[1:]
+	}
+}
+
+// onFrame() is called when a frame comes back
+func (l *lipSync) onFrame() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.chunks) == 0 {
+		// no audio yet, nothing to measure
+		return
+	}
+	at := l.frames * 1000 / l.fps
+	l.frames++
+
+	for i, c := range l.chunks {
+		if c.media < at {
+			continue
+		}
+		rtt := time.Since(c.sent)
+		if l.srtt == 0 {
+			l.srtt = rtt
+		} else {
+			l.srtt += (rtt - l.srtt) / rttSmooth
+		}
+		l.chunks = l.chunks[i:]
+		return
+	}
+	// frame is ahead of the audio sent
+}
+
+// reset() starts counting over, as a new server session does; the estimate is kept
+func (l *lipSync) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.bytes, l.frames, l.chunks = 0, 0, nil
+}
+
+// Delay() is how long the outgoing audio is to be held
+func (l *lipSync) Delay() (d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	d = l.srtt
+	if d > maxLipDelay {
+		d = maxLipDelay
+	}
+	return
+}
+
+func (l *lipSync) rtt() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.srtt
+}
@@ -0,0 +1,43 @@
+package anim
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLipSync(t *testing.T) {
+	l := newLipSync(20) // 50 ms per frame
+
+	l.onFrame() // no audio yet, ignored
+	if l.Delay() != 0 || l.frames != 0 {
+		t.Fatal("frame before audio is measured")
+	}
+
+	for i := 0; i < 4; i++ {
+		l.onChunk(50 * pcmBytesPerMs)
+	}
+	time.Sleep(40 * time.Millisecond)
+
+	l.onFrame() // media 0 ms, 1st chunk
+	l.onFrame() // media 50 ms, still 1st chunk
+	l.onFrame() // media 100 ms, 2nd chunk
+	if d := l.Delay(); d < 40*time.Millisecond || d > 200*time.Millisecond {
+		t.Fatal("unexpected delay", d)
+	}
+	if len(l.chunks) != 3 {
+		t.Fatal("chunks not consumed", len(l.chunks))
+	}
+
+	// frames ahead of the audio are not measured
+	l.onFrame()
+	l.onFrame()
+	l.onFrame()
+	if len(l.chunks) != 1 {
+		t.Fatal("unexpected chunks", len(l.chunks))
+	}
+
+	l.srtt = 5 * time.Second
+	if l.Delay() != maxLipDelay {
+		t.Fatal("delay is not limited")
+	}
+}
@@ -0,0 +1,126 @@
+package anim
+
+// #cgo linux CFLAGS: -I/usr/include/opus
+// #cgo linux LDFLAGS: -L/usr/lib/x86_64-linux-gnu -lopus
+// #include <opus.h>
+import "C"
+import (
+	"fmt"
+)
+
+// decoder is libopus, a fake in tests
+type decoder interface {
+	Decode(data []byte, pcm []int16, fec bool) (samples int, err error) // nil data - plc
+	Samples(data []byte) int                                            // in the packet, all the frames
+	Close() error
+}
+
+// opusDecoder makes 48 kHz mono pcm
+type opusDecoder struct {
+	dec *C.OpusDecoder
+}
+
+func newOpusDecoder() (o *opusDecoder, err error) {
+	e := C.int(0)
+	o = &opusDecoder{dec: C.opus_decoder_create(C.int(opusRate), C.int(audiochan), &e)}
+	if e != C.OPUS_OK || o.dec == nil {
+		err = fmt.Errorf("opus decoder: %d", int(e))
+		o = nil
+	}
+	return
+}
+
+func (o *opusDecoder) Decode(data []byte, pcm []int16, fec bool) (samples int, err error) {
+	var p *C.uchar
+	if len(data) > 0 {
+		p = (*C.uchar)(&data[0])
+	}
+	var f C.int
+	if fec {
+		f = 1
+	}
+	n := C.opus_decode(o.dec, p, C.opus_int32(len(data)), (*C.opus_int16)(&pcm[0]), C.int(len(pcm)/audiochan), f)
+	if n < 0 {
+		err = fmt.Errorf("%w: %d", ErrDecoding, int(n))
+		return
+	}
+	samples = int(n)
+	return
+}
+
+func (o *opusDecoder) Samples(data []byte) int {
+	if len(data) == 0 {
+		return 0
+	}
+	return int(C.opus_packet_get_nb_samples((*C.uchar)(&data[0]), C.opus_int32(len(data)), C.int(opusRate)))
+}
+
+func (o *opusDecoder) Close() error {
+	C.opus_decoder_destroy(o.dec)
+	return nil
+}
+
+// hasLbrr() tells that the packet carries in-band fec of the previous one,
+// as opus_packet_has_lbrr() of libopus 1.5 does: the flag follows silk vad flags of the 1st frame
+func hasLbrr(p []byte) bool {
+	if len(p) < 2 {
+		return false
+	}
+	toc := p[0]
+	config := int(toc >> 3)
+	if config >= 16 {
+		// celt only
+		return false
+	}
+	// silk frames of 20 ms in the opus frame: silk 10/20/40/60 ms, hybrid 10/20 ms
+	ms := []int{10, 20, 40, 60}[config&3]
+	if config >= 12 {
+		ms = []int{10, 20}[config&1]
+	}
+	nb := 1
+	if ms > 20 {
+		nb = ms / 20
+	}
+
+	// the 1st frame
+	off := 1
+	switch toc & 3 {
+	case 2:
+		off = 2
+		if p[1] >= 252 {
+			off = 3
+		}
+	case 3:
+		count := p[1]
+		off = 2
+		if count&0x40 != 0 {
+			// padding length
+			for off < len(p) {
+				b := p[off]
+				off++
+				if b != 255 {
+					break
+				}
+			}
+		}
+		if count&0x80 != 0 {
+			// vbr, sizes of all the frames but the last
+			for i := 0; i < int(count&0x3f)-1 && off < len(p); i++ {
+				if p[off] >= 252 {
+					off++
+				}
+				off++
+			}
+		}
+	}
+	if off >= len(p) {
+		return false
+	}
+	b := p[off]
+	lbrr := (b >> (7 - nb)) & 1
+	if toc&0x04 != 0 {
+		// stereo, side channel
+		lbrr |= (b >> (6 - 2*nb)) & 1
+	}
+	return lbrr != 0
+}
@@ -0,0 +1,51 @@
+package anim
+
+// #cgo linux CFLAGS: -I/usr/include/opus
+// #cgo linux LDFLAGS: -L/usr/lib/x86_64-linux-gnu -lopus
+// #include <opus.h>
+import "C"
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	opusFrame    = opusRate / 50 // samples, 20 ms
+	opusMaxBytes = 1500
+)
+
+// opusEncoder makes 20 ms mono frames of 48 kHz pcm
+type opusEncoder struct {
+	enc *C.OpusEncoder
+}
+
+func newOpusEncoder() (o *opusEncoder, err error) {
+	e := C.int(0)
+	o = &opusEncoder{enc: C.opus_encoder_create(C.opus_int32(opusRate), C.int(audiochan), C.OPUS_APPLICATION_VOIP, &e)}
+	if e != C.OPUS_OK || o.enc == nil {
+		err = fmt.Errorf("opus encoder: %d", int(e))
+		o = nil
+	}
+	return
+}
+
+// Encode() takes opusFrame samples, 16 bit le; a shorter frame is padded with silence
+func (o *opusEncoder) Encode(pcm []byte) (frame []byte, err error) {
+	samples := make([]int16, opusFrame*audiochan)
+	for i := 0; i < len(samples) && 2*i+1 < len(pcm); i++ {
+		samples[i] = int16(binary.LittleEndian.Uint16(pcm[2*i:]))
+	}
+	out := make([]byte, opusMaxBytes)
+	n := C.opus_encode(o.enc, (*C.opus_int16)(&samples[0]), C.int(opusFrame), (*C.uchar)(&out[0]), C.opus_int32(len(out)))
+	if n < 0 {
+		err = fmt.Errorf("opus encoding: %d", int(n))
+		return
+	}
+	frame = out[:n]
+	return
+}
+
+func (o *opusEncoder) Close() error {
+	C.opus_encoder_destroy(o.enc)
+	return nil
+}
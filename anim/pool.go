@@ -0,0 +1,190 @@
+package anim
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/dmisol/animportal/defs"
+	"github.com/dmisol/animportal/wire"
+)
+
+const defCheck = 10 * time.Second
+
+var (
+	ErrNoServer = errors.New("No animation server available")
+	ErrConnect  = errors.New("Can't connect animation server")
+)
+
+// Pool spreads sessions over animation servers, the ones failing health checks are avoided
+type Pool struct {
+	mu       sync.Mutex
+	servers  []*server
+	weighted bool
+	check    time.Duration
+}
+
+type server struct {
+	defs.AnimServer
+	sessions int
+	healthy  bool
+	err      error // last failure
+}
+
+// ServerStats is a snapshot of a server in the pool, for monitoring
+type ServerStats struct {
+	Addr     string `json:"addr"`
+	Capacity int    `json:"capacity"`
+	Sessions int    `json:"sessions"`
+	Healthy  bool   `json:"healthy"`
+	Error    string `json:"error,omitempty"`
+}
+
+// NewPool() uses AnimServers, or AnimAddr alone, unlimited
+func NewPool(conf defs.PortalConf) (pl *Pool) {
+	pl = &Pool{weighted: conf.Balance == defs.BalanceWeighted, check: conf.AnimCheck}
+	if pl.check <= 0 {
+		pl.check = defCheck
+	}
+	list := conf.AnimServers
+	if len(list) == 0 {
+		list = []defs.AnimServer{{Addr: conf.AnimAddr}}
+	}
+	for _, s := range list {
+		// healthy till the first check tells otherwise
+		pl.servers = append(pl.servers, &server{AnimServer: s, healthy: true})
+	}
+	return
+}
+
+// Run() checks the servers till ctx is over
+func (pl *Pool) Run(ctx context.Context) {
+	t := time.NewTicker(pl.check)
+	defer t.Stop()
+	for {
+		pl.checkAll(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (pl *Pool) checkAll(ctx context.Context) {
+	pl.mu.Lock()
+	list := append([]*server(nil), pl.servers...)
+	pl.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, s := range list {
+		wg.Add(1)
+		go func(s *server) {
+			defer wg.Done()
+			pl.mark(s, probe(ctx, s.Addr))
+		}(s)
+	}
+	wg.Wait()
+}
+
+// probe() connects and says hello
+func probe(ctx context.Context, addr string) (err error) {
+	d := &net.Dialer{Timeout: dialTimeout}
+	var c net.Conn
+	if c, err = d.DialContext(ctx, "tcp", addr); err != nil {
+		return
+	}
+	conn := wire.NewConn(c)
+	defer conn.Close()
+
+	if err = conn.Hello(); err != nil {
+		return
+	}
+	conn.Send(wire.Bye, nil)
+	return
+}
+
+// mark() records the result of a check or a session setup
+func (pl *Pool) mark(s *server, err error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	healthy := err == nil
+	if s.healthy != healthy {
+		if healthy {
+			pl.Println(s.Addr, "is back")
+		} else {
+			pl.Println(s.Addr, "is down:", err)
+		}
+	}
+	s.healthy, s.err = healthy, err
+}
+
+// acquire() picks the least loaded server with room for a session, skipping tried;
+// failed ones are the last resort, dialing is a check as well
+func (pl *Pool) acquire(tried map[*server]bool) (best *server, err error) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	for _, s := range pl.servers {
+		if tried[s] || (s.Capacity > 0 && s.sessions >= s.Capacity) {
+			continue
+		}
+		if best == nil || (s.healthy && !best.healthy) ||
+			(s.healthy == best.healthy && pl.load(s) < pl.load(best)) {
+			best = s
+		}
+	}
+	if best == nil {
+		err = ErrNoServer
+		return
+	}
+	best.sessions++
+	return
+}
+
+// load() compares servers: sessions, or sessions per weight
+func (pl *Pool) load(s *server) float64 {
+	if !pl.weighted {
+		return float64(s.sessions)
+	}
+	w := s.Weight
+	if w <= 0 {
+		w = s.Capacity
+	}
+	if w <= 0 {
+		w = 1
+	}
+	return float64(s.sessions) / float64(w)
+}
+
+func (pl *Pool) release(s *server) {
+	if s == nil {
+		return
+	}
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	s.sessions--
+}
+
+func (pl *Pool) Stats() (list []ServerStats) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	for _, s := range pl.servers {
+		ss := ServerStats{Addr: s.Addr, Capacity: s.Capacity, Sessions: s.sessions, Healthy: s.healthy}
+		if s.err != nil {
+			ss.Error = s.err.Error()
+		}
+		list = append(list, ss)
+	}
+	return
+}
+
+func (pl *Pool) Println(i ...interface{}) {
+	log.Println("anim.pool", i)
+}
@@ -0,0 +1,130 @@
+package anim
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/dmisol/animportal/defs"
+	"github.com/dmisol/animportal/wire"
+)
+
+func TestPlacement(t *testing.T) {
+	pl := NewPool(defs.PortalConf{AnimServers: []defs.AnimServer{
+		{Addr: "a", Capacity: 2},
+		{Addr: "b", Capacity: 4},
+	}})
+
+	// least: fewest sessions, a first on ties
+	var got []string
+	for i := 0; i < 6; i++ {
+		s, err := pl.acquire(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, s.Addr)
+	}
+	if want := "abab" + "bb"; join(got) != want {
+		t.Fatal("unexpected placement", got)
+	}
+	if _, err := pl.acquire(nil); err != ErrNoServer {
+		t.Fatal("ErrNoServer expected, got", err)
+	}
+
+	// weighted: b takes twice as many
+	pl = NewPool(defs.PortalConf{Balance: defs.BalanceWeighted, AnimServers: []defs.AnimServer{
+		{Addr: "a", Capacity: 2},
+		{Addr: "b", Capacity: 4},
+	}})
+	got = nil
+	for i := 0; i < 6; i++ {
+		s, _ := pl.acquire(nil)
+		got = append(got, s.Addr)
+	}
+	if want := "abbabb"; join(got) != want {
+		t.Fatal("unexpected placement", got)
+	}
+
+	// the failed one is avoided while others have room
+	pl = NewPool(defs.PortalConf{AnimServers: []defs.AnimServer{{Addr: "a"}, {Addr: "b"}}})
+	pl.mark(pl.servers[0], ErrConnect)
+	s, _ := pl.acquire(nil)
+	s2, _ := pl.acquire(nil)
+	if s.Addr != "b" || s2.Addr != "b" {
+		t.Fatal("unhealthy server is used")
+	}
+	if s, _ = pl.acquire(map[*server]bool{s: true}); s.Addr != "a" {
+		t.Fatal("no last resort")
+	}
+	pl.release(s)
+	if st := pl.Stats(); st[0].Sessions != 0 || st[0].Healthy || st[0].Error == "" || st[1].Sessions != 2 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+}
+
+func join(list []string) (s string) {
+	for _, x := range list {
+		s += x
+	}
+	return
+}
+
+func TestFailover(t *testing.T) {
+	// refuses: listens no more
+	l1, _ := net.Listen("tcp", "127.0.0.1:0")
+	dead := l1.Addr().String()
+	l1.Close()
+
+	l2, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l2.Close()
+	go func() {
+		for {
+			c, err := l2.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				conn := wire.NewConn(c)
+				defer conn.Close()
+				conn.Accept()
+				for {
+					// init, till bye or closed
+					if m, err := conn.Recv(); err != nil || m.Type == wire.Bye {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	pl := NewPool(defs.PortalConf{AnimServers: []defs.AnimServer{{Addr: dead}, {Addr: l2.Addr().String(), Capacity: 1}}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	pl.checkAll(ctx)
+	if st := pl.Stats(); st[0].Healthy || !st[1].Healthy {
+		t.Fatalf("unexpected health %+v", st)
+	}
+	pl.mark(pl.servers[0], nil) // not checked yet, as if just came back
+
+	p := &animation{pool: pl}
+	conn, s, err := p.place(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if s.Addr != l2.Addr().String() {
+		t.Fatal("placed at", s.Addr)
+	}
+	if st := pl.Stats(); st[0].Healthy || st[0].Sessions != 0 || st[1].Sessions != 1 {
+		t.Fatalf("unexpected stats %+v", st)
+	}
+
+	// l2 is full, nothing else to fail over to
+	if _, _, err = p.place(ctx); !errors.Is(err, ErrConnect) {
+		t.Fatal("ErrConnect expected, got", err)
+	}
+}
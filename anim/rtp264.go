@@ -0,0 +1,248 @@
+package anim
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+
+	"github.com/pion/rtp"
+	"github.com/pion/webrtc/v3"
+)
+
+const (
+	h264Clock = 90000
+	rtpMtu    = 1200 // payload bytes
+
+	nalSps   = 7
+	nalPps   = 8
+	nalStapA = 24
+	nalFuA   = 28
+
+	h264Fmtp = "level-asymmetry-allowed=1;packetization-mode=1;profile-level-id=42e01f"
+)
+
+func newH264Track() (*webrtc.TrackLocalStaticRTP, error) {
+	return webrtc.NewTrackLocalStaticRTP(webrtc.RTPCodecCapability{
+		MimeType:    webrtc.MimeTypeH264,
+		ClockRate:   h264Clock,
+		SDPFmtpLine: h264Fmtp,
+	}, "video", "flexatar")
+}
+
+// h264Packetizer splits annex-b access units into rtp packets, RFC 6184 non-interleaved mode
+// timestamps are derived from frame index, not from the wall clock
+// sps/pps are repeated once per second: with intra refresh there are no more idr frames to carry them
+type h264Packetizer struct {
+	mtu   int
+	fps   int
+	seq   uint16
+	ts0   uint32
+	frame uint64
+
+	sets    [][]byte // the last sps/pps seen
+	pending bool     // sets came alone, not sent yet
+}
+
+func newH264Packetizer(fps int) *h264Packetizer {
+	if fps <= 0 {
+		fps = 24
+	}
+	return &h264Packetizer{
+		mtu: rtpMtu,
+		fps: fps,
+		seq: uint16(rand.Uint32()),
+		ts0: rand.Uint32(),
+	}
+}
+
+// Packetize() makes packets for the next frame; marker is set on the last one
+// sps/pps written alone, as x264 does with headers, make no packets and go with the next frame
+func (h *h264Packetizer) Packetize(au []byte) (pkts []*rtp.Packet) {
+	nals := splitNALs(au)
+	if len(nals) == 0 {
+		return
+	}
+	sets := parameterSets(nals)
+	if len(sets) == len(nals) {
+		h.keep(sets)
+		h.pending = true
+		return
+	}
+	if len(sets) > 0 {
+		h.keep(sets)
+	} else if len(h.sets) > 0 && (h.pending || h.frame%uint64(h.fps) == 0) {
+		nals = append(append([][]byte{}, h.sets...), nals...)
+	}
+	h.pending = false
+
+	ts := h.ts0 + uint32(h.frame*h264Clock/uint64(h.fps))
+	h.frame++
+
+	var stap [][]byte
+	stapLen := 1
+	flush := func() {
+		switch len(stap) {
+		case 0:
+			return
+		case 1:
+			pkts = append(pkts, h.packet(ts, stap[0]))
+		default:
+			pkts = append(pkts, h.packet(ts, stapA(stap)))
+		}
+		stap = nil
+		stapLen = 1
+	}
+
+	for _, nal := range nals {
+		if len(nal) > h.mtu {
+			flush()
+			for _, fu := range fuA(nal, h.mtu) {
+				pkts = append(pkts, h.packet(ts, fu))
+			}
+			continue
+		}
+		if stapLen+2+len(nal) > h.mtu {
+			flush()
+		}
+		stap = append(stap, nal)
+		stapLen += 2 + len(nal)
+	}
+	flush()
+
+	if len(pkts) > 0 {
+		pkts[len(pkts)-1].Marker = true
+	}
+	return
+}
+
+// keep() copies sets, the writer may reuse the buffer
+func (h *h264Packetizer) keep(sets [][]byte) {
+	h.sets = h.sets[:0]
+	for _, n := range sets {
+		h.sets = append(h.sets, append([]byte{}, n...))
+	}
+}
+
+func parameterSets(nals [][]byte) (sets [][]byte) {
+	for _, n := range nals {
+		if t := n[0] & 0x1f; t == nalSps || t == nalPps {
+			sets = append(sets, n)
+		}
+	}
+	return
+}
+
+func (h *h264Packetizer) packet(ts uint32, payload []byte) (p *rtp.Packet) {
+	p = &rtp.Packet{
+		Header: rtp.Header{
+			Version:        2,
+			SequenceNumber: h.seq,
+			Timestamp:      ts,
+		},
+		Payload: payload,
+	}
+	h.seq++
+	return
+}
+
+func stapA(nals [][]byte) (b []byte) {
+	var f, nri byte
+	for _, n := range nals {
+		f |= n[0] & 0x80
+		if x := n[0] & 0x60; x > nri {
+			nri = x
+		}
+	}
+	b = append(b, f|nri|nalStapA)
+	for _, n := range nals {
+		b = append(b, byte(len(n)>>8), byte(len(n)))
+		b = append(b, n...)
+	}
+	return
+}
+
+func fuA(nal []byte, mtu int) (fus [][]byte) {
+	indicator := nal[0]&0xe0 | nalFuA
+	typ := nal[0] & 0x1f
+	data := nal[1:]
+	max := mtu - 2
+
+	for len(data) > 0 {
+		n := len(data)
+		if n > max {
+			n = max
+		}
+		hdr := typ
+		if len(fus) == 0 {
+			hdr |= 0x80 // start
+		}
+		if n == len(data) {
+			hdr |= 0x40 // end
+		}
+		fu := make([]byte, 2+n)
+		fu[0], fu[1] = indicator, hdr
+		copy(fu[2:], data[:n])
+		fus = append(fus, fu)
+		data = data[n:]
+	}
+	return
+}
+
+// splitNALs() finds nal units between 3 or 4 byte start codes
+func splitNALs(au []byte) (nals [][]byte) {
+	start := -1
+	for i := 0; i+2 < len(au); {
+		if au[i] == 0 && au[i+1] == 0 && au[i+2] == 1 {
+			if start >= 0 {
+				nals = appendNAL(nals, au[start:i])
+			}
+			i += 3
+			start = i
+			continue
+		}
+		i++
+	}
+	if start >= 0 {
+		nals = appendNAL(nals, au[start:])
+	} else if len(au) > 0 {
+		// no start codes, single nal
+		nals = appendNAL(nals, au)
+	}
+	return
+}
+
+func appendNAL(nals [][]byte, nal []byte) [][]byte {
+	// trailing zero belongs to the next 4 byte start code
+	nal = bytes.TrimRight(nal, "\x00")
+	if len(nal) == 0 {
+		return nals
+	}
+	return append(nals, nal)
+}
+
+// rtpH264 is io.Writer for the encoder, one Write() per access unit or headers
+type rtpH264 struct {
+	mu    sync.Mutex
+	track *webrtc.TrackLocalStaticRTP
+	*h264Packetizer
+}
+
+func newRtpH264(track *webrtc.TrackLocalStaticRTP, fps int) *rtpH264 {
+	return &rtpH264{
+		track:          track,
+		h264Packetizer: newH264Packetizer(fps),
+	}
+}
+
+func (r *rtpH264) Write(au []byte) (i int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, p := range r.Packetize(au) {
+		if err = r.track.WriteRTP(p); err != nil {
+			return
+		}
+	}
+	i = len(au)
+	return
+}
@@ -0,0 +1,102 @@
+package anim
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/pion/rtp"
+	"github.com/pion/rtp/codecs"
+)
+
+func TestH264Packetizer(t *testing.T) {
+	sps := []byte{0x67, 0x42, 0xc0, 0x1f}
+	pps := []byte{0x68, 0xce, 0x3c, 0x80}
+	idr := make([]byte, 3000)
+	idr[0] = 0x65
+	for i := 1; i < len(idr); i++ {
+		idr[i] = byte(i)
+	}
+	sc := []byte{0, 0, 0, 1}
+	au := bytes.Join([][]byte{nil, sps, pps, idr}, sc)
+
+	h := newH264Packetizer(25)
+	pkts := h.Packetize(au)
+
+	// stap-a with sps+pps, then fu-a fragments of idr
+	if len(pkts) != 1+3 {
+		t.Fatal("unexpected packets", len(pkts))
+	}
+	if pkts[0].Payload[0]&0x1f != nalStapA {
+		t.Fatal("stap-a expected, got", pkts[0].Payload[0]&0x1f)
+	}
+	for i, p := range pkts {
+		if len(p.Payload) > rtpMtu {
+			t.Fatal("too large", i, len(p.Payload))
+		}
+		if p.Marker != (i == len(pkts)-1) {
+			t.Fatal("marker", i, p.Marker)
+		}
+		if p.SequenceNumber != pkts[0].SequenceNumber+uint16(i) {
+			t.Fatal("seq", i)
+		}
+		if p.Timestamp != pkts[0].Timestamp {
+			t.Fatal("timestamp", i)
+		}
+	}
+
+	// depacketized annex-b is the same
+	var out []byte
+	d := &codecs.H264Packet{}
+	for _, p := range pkts {
+		b, err := d.Unmarshal(p.Payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, b...)
+	}
+	if !bytes.Equal(out, au) {
+		t.Fatal("depacketized stream differs", len(out), len(au))
+	}
+
+	// 90 kHz, from frame index
+	next := h.Packetize(append(append([]byte{}, sc...), 0x41, 1, 2))
+	if len(next) != 1 || next[0].Timestamp-pkts[0].Timestamp != 90000/25 || !next[0].Marker {
+		t.Fatal("unexpected next frame", len(next), next[0].Timestamp-pkts[0].Timestamp)
+	}
+}
+
+func TestH264Headers(t *testing.T) {
+	sc := []byte{0, 0, 0, 1}
+	sps := []byte{0x67, 0x42, 0xc0, 0x1f}
+	pps := []byte{0x68, 0xce, 0x3c, 0x80}
+	h := newH264Packetizer(2)
+
+	// x264 writes headers alone
+	if pkts := h.Packetize(bytes.Join([][]byte{nil, sps, pps}, sc)); len(pkts) != 0 || h.frame != 0 {
+		t.Fatal("headers made a frame", len(pkts), h.frame)
+	}
+
+	count := func(pkts []*rtp.Packet) (sets int) {
+		d := &codecs.H264Packet{}
+		for _, p := range pkts {
+			b, _ := d.Unmarshal(p.Payload)
+			for _, n := range splitNALs(b) {
+				if t := n[0] & 0x1f; t == nalSps || t == nalPps {
+					sets++
+				}
+			}
+		}
+		return
+	}
+	idr := h.Packetize(append(append([]byte{}, sc...), 0x65, 1, 2))
+	if count(idr) != 2 || idr[0].Timestamp != h.ts0 || !idr[len(idr)-1].Marker {
+		t.Fatal("headers do not go with the first frame")
+	}
+	if p := h.Packetize(append(append([]byte{}, sc...), 0x41, 3)); count(p) != 0 || p[0].Timestamp-h.ts0 != 90000/2 {
+		t.Fatal("unexpected 2nd frame")
+	}
+	// repeated once per second, for the ones subscribed later
+	if p := h.Packetize(append(append([]byte{}, sc...), 0x41, 4)); count(p) != 2 {
+		t.Fatal("headers are not repeated")
+	}
+}
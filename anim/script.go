@@ -0,0 +1,172 @@
+package anim
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/dmisol/animportal/defs"
+	"github.com/dmisol/animportal/tts"
+	"github.com/dmisol/animportal/wire"
+)
+
+var (
+	ErrNoScripts = errors.New("Scripts are not configured")
+	ErrScript    = errors.New("Malformed script")
+	ErrPlaying   = errors.New("Script is playing")
+)
+
+// ParseScript() reads defs.Anim entries, either json array or one per line;
+// entries are sorted by Ts
+func ParseScript(r io.Reader) (script []*defs.Anim, err error) {
+	br := bufio.NewReader(r)
+	var first []byte
+	for {
+		if first, err = br.Peek(1); err != nil {
+			err = fmt.Errorf("%w: empty", ErrScript)
+			return
+		}
+		if !strings.ContainsAny(string(first), " \t\r\n") {
+			break
+		}
+		br.ReadByte()
+	}
+
+	dec := json.NewDecoder(br)
+	if first[0] == '[' {
+		err = dec.Decode(&script)
+	} else {
+		for dec.More() {
+			a := &defs.Anim{}
+			if err = dec.Decode(a); err != nil {
+				break
+			}
+			script = append(script, a)
+		}
+	}
+	if err != nil {
+		err = fmt.Errorf("%w: %v", ErrScript, err)
+		script = nil
+		return
+	}
+	for i, a := range script {
+		if a == nil || a.Ts < 0 {
+			err = fmt.Errorf("%w: entry %d", ErrScript, i)
+			script = nil
+			return
+		}
+	}
+	sort.SliceStable(script, func(i, j int) bool { return script[i].Ts < script[j].Ts })
+	return
+}
+
+// Play() starts the script, audio is said and phones, patterns are sent on schedule
+// returns when the last entry starts
+func (e *Engine) Play(script []*defs.Anim) (d time.Duration, err error) {
+	if e.scripts == "" {
+		err = ErrNoScripts
+		return
+	}
+	// check files before starting
+	for _, a := range script {
+		if a.Audio == "" {
+			continue
+		}
+		if _, err = e.scriptFile(a.Audio); err != nil {
+			return
+		}
+	}
+	if !atomic.CompareAndSwapInt32(&e.playing, 0, 1) {
+		err = ErrPlaying
+		return
+	}
+	if len(script) > 0 {
+		d = time.Duration(script[len(script)-1].Ts) * time.Millisecond
+	}
+	go e.play(script)
+	return
+}
+
+func (e *Engine) play(script []*defs.Anim) {
+	defer atomic.StoreInt32(&e.playing, 0)
+
+	start := time.Now()
+	for _, a := range script {
+		if !e.sleepUntil(start.Add(time.Duration(a.Ts) * time.Millisecond)) {
+			return
+		}
+		if a.Audio != "" {
+			u, err := e.loadUtterance(a.Audio)
+			if err != nil {
+				e.Println("play", a.Audio, err)
+			} else {
+				select {
+				case <-e.Context.Done():
+					return
+				case e.say <- u:
+				}
+			}
+		}
+		if len(a.Phones) == 0 && len(a.Pattern) == 0 {
+			continue
+		}
+		// file names are local, the server gets the rest
+		ts := int(e.clock.stamp(0).Milliseconds())
+		phones := make([]*defs.Viseme, 0, len(a.Phones))
+		for _, p := range a.Phones {
+			v := *p
+			v.Time += ts - a.Ts
+			phones = append(phones, &v)
+		}
+		err := e.animation.WriteAnim(&defs.Anim{Ts: ts, Phones: phones, Pattern: a.Pattern}, nil)
+		if errors.Is(err, wire.ErrVersion) {
+			e.Println("play", err)
+			return
+		}
+		if err != nil {
+			e.Println("play", err)
+		}
+	}
+}
+
+// scriptFile() resolves the name inside the scripts folder
+func (e *Engine) scriptFile(name string) (file string, err error) {
+	file = filepath.Join(e.scripts, filepath.Clean("/"+name))
+	if _, err = os.Stat(file); err != nil {
+		err = fmt.Errorf("%w: %v", ErrScript, err)
+	}
+	return
+}
+
+// loadUtterance() reads wav, or raw 16 kHz pcm otherwise
+func (e *Engine) loadUtterance(name string) (u *utterance, err error) {
+	var file string
+	if file, err = e.scriptFile(name); err != nil {
+		return
+	}
+	var b []byte
+	if b, err = os.ReadFile(file); err != nil {
+		return
+	}
+	s := &tts.Speech{Pcm: b, Rate: voskRate}
+	if bytes.HasPrefix(b, []byte("RIFF")) {
+		if s, err = tts.ParseWav(b); err != nil {
+			return
+		}
+	}
+	u = &utterance{}
+	if u.pcm16, err = resampled(s, voskRate); err != nil {
+		return
+	}
+	u.pcm48, err = resampled(s, opusRate)
+	return
+}
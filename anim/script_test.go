@@ -0,0 +1,58 @@
+package anim
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestParseScript(t *testing.T) {
+	for _, src := range []string{
+		`[{"ts": 500, "pattern": [0.1, 0.2]}, {"ts": 0, "audio": "hello.wav"}]`,
+		"\n{\"ts\": 500, \"pattern\": [0.1, 0.2]}\n{\"ts\": 0, \"audio\": \"hello.wav\"}\n",
+	} {
+		script, err := ParseScript(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(script) != 2 || script[0].Audio != "hello.wav" || script[1].Ts != 500 || len(script[1].Pattern) != 2 {
+			t.Fatal("unexpected script", src)
+		}
+	}
+	for _, src := range []string{"", "  ", `[{"ts": "x"}]`, `{"ts": 1} {`, `[null]`, `{"ts": -1}`} {
+		if _, err := ParseScript(strings.NewReader(src)); !errors.Is(err, ErrScript) {
+			t.Fatal("ErrScript expected for", src, "got", err)
+		}
+	}
+}
+
+func TestScriptFile(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(path.Join(dir, "a.pcm"), make([]byte, 3200), 0666)
+
+	e := &Engine{scripts: dir}
+	if _, err := e.Play(nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a.pcm", "/a.pcm", "x/../a.pcm"} {
+		if _, err := e.scriptFile(name); err != nil {
+			t.Fatal(name, err)
+		}
+	}
+	// no way out
+	os.WriteFile(path.Join(path.Dir(dir), "b.pcm"), nil, 0666)
+	if _, err := e.scriptFile("../b.pcm"); !errors.Is(err, ErrScript) {
+		t.Fatal("ErrScript expected, got", err)
+	}
+
+	u, err := e.loadUtterance("a.pcm")
+	if err != nil || len(u.pcm16) != 3200 {
+		t.Fatal("unexpected utterance", err)
+	}
+
+	if _, err = (&Engine{}).Play(nil); err != ErrNoScripts {
+		t.Fatal("ErrNoScripts expected, got", err)
+	}
+}
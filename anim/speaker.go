@@ -0,0 +1,172 @@
+package anim
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/dmisol/animportal/tts"
+	"github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/zaf/resample"
+)
+
+const (
+	sayQueue = 4 // utterances waiting to be said
+)
+
+var (
+	ErrBusy = errors.New("Too much to say")
+)
+
+// utterance is synthesized speech, for animation and for the hall
+type utterance struct {
+	pcm16 []byte
+	pcm48 []byte
+}
+
+func newSpeechTrack() (*webrtc.TrackLocalStaticSample, error) {
+	return webrtc.NewTrackLocalStaticSample(webrtc.RTPCodecCapability{
+		MimeType:  webrtc.MimeTypeOpus,
+		ClockRate: opusRate,
+		Channels:  2,
+	}, "speech", "flexatar")
+}
+
+// Say() synthesizes the text and queues it; returns how long it takes to say
+func (e *Engine) Say(text string) (d time.Duration, err error) {
+	if e.tts == nil {
+		err = tts.ErrNoTts
+		return
+	}
+	var s *tts.Speech
+	if s, err = e.tts.Synthesize(e.Context, text); err != nil {
+		return
+	}
+	u := &utterance{}
+	if u.pcm16, err = resampled(s, voskRate); err != nil {
+		return
+	}
+	if u.pcm48, err = resampled(s, opusRate); err != nil {
+		return
+	}
+	select {
+	case e.say <- u:
+		d = s.Duration()
+	default:
+		err = ErrBusy
+	}
+	return
+}
+
+// speak() says queued utterances one by one
+func (e *Engine) speak() {
+	for {
+		select {
+		case <-e.Context.Done():
+			return
+		case u := <-e.say:
+			e.utter(u)
+		}
+	}
+}
+
+// utter() feeds pcm for animation in real time, as if the owner spoke,
+// the hall gets the speech delayed to keep lips in sync
+func (e *Engine) utter(u *utterance) {
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.sayAudio(u.pcm48, start.Add(e.animation.lips.Delay()))
+	}()
+	defer func() { <-done }()
+
+	chunks := newChunker(e.pipeline(), e.chunk, e.clock)
+	defer func() {
+		if err := chunks.Flush(); err != nil {
+			e.Println("say", err)
+		}
+	}()
+	for i := 0; i*chunks.size < len(u.pcm16); i++ {
+		if !e.sleepUntil(start.Add(time.Duration(i*chunks.size/pcmBytesPerMs) * time.Millisecond)) {
+			return
+		}
+		end := (i + 1) * chunks.size
+		if end > len(u.pcm16) {
+			end = len(u.pcm16)
+		}
+		if _, err := chunks.Write(u.pcm16[i*chunks.size : end]); err != nil {
+			e.Println("say", err)
+			return
+		}
+	}
+}
+
+func (e *Engine) sayAudio(pcm []byte, start time.Time) {
+	enc, err := newOpusEncoder()
+	if err != nil {
+		e.Println("say", err)
+		return
+	}
+	defer enc.Close()
+
+	step := opusFrame * audiochan * 2
+	dt := time.Second * opusFrame / opusRate
+	for i := 0; i*step < len(pcm); i++ {
+		if !e.sleepUntil(start.Add(time.Duration(i) * dt)) {
+			return
+		}
+		if e.isMuted() {
+			continue
+		}
+		end := (i + 1) * step
+		if end > len(pcm) {
+			end = len(pcm)
+		}
+		var frame []byte
+		if frame, err = enc.Encode(pcm[i*step : end]); err != nil {
+			e.Println("say", err)
+			return
+		}
+		if err = e.speech.WriteSample(media.Sample{Data: frame, Duration: dt}); err != nil {
+			e.Println("say", err)
+			return
+		}
+	}
+}
+
+// sleepUntil() returns false if the engine is closed meanwhile
+func (e *Engine) sleepUntil(t time.Time) bool {
+	d := time.Until(t)
+	if d <= 0 {
+		return e.Context.Err() == nil
+	}
+	select {
+	case <-e.Context.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// resampled() converts speech to the rate given
+func resampled(s *tts.Speech, rate int) (pcm []byte, err error) {
+	if s.Rate == rate {
+		return s.Pcm, nil
+	}
+	var buf bytes.Buffer
+	var res *resample.Resampler
+	if res, err = resample.New(&buf, float64(s.Rate), float64(rate), audiochan, resample.I16, resample.HighQ); err != nil {
+		return
+	}
+	if _, err = res.Write(s.Pcm); err != nil {
+		res.Close()
+		return
+	}
+	if err = res.Close(); err != nil {
+		return
+	}
+	pcm = buf.Bytes()
+	return
+}
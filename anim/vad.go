@@ -0,0 +1,126 @@
+package anim
+
+import (
+	"encoding/binary"
+	"math"
+	"sync"
+	"time"
+)
+
+const (
+	vadMinDb    = -55.0 // dBFS, quieter is silence whatever the noise is
+	vadMarginDb = 9.0   // above the noise floor to be speech
+	vadMaxZcr   = 0.45  // crossings per sample, noise-like if above
+	vadFloorUp  = 0.01  // noise floor follows rising level slowly, ~5s for 50ms chunks
+	vadHangover = 300 * time.Millisecond
+)
+
+// idleWriter may replace silent pcm with something lighter
+type idleWriter interface {
+	chunkWriter
+	WriteIdle(media time.Duration, pcm []byte) error
+}
+
+// VadStats are counted per session
+type VadStats struct {
+	Speech  int64   `json:"speech"`  // chunks
+	Silence int64   `json:"silence"` // chunks
+	Ratio   float64 `json:"ratio"`   // speech / all
+}
+
+// vad marks chunks as speech or silence by energy and zero crossing rate
+// chunker -> vad -> animation
+// silence is sent with WriteIdle() if gate is set, as pcm otherwise
+type vad struct {
+	mu   sync.Mutex
+	dest idleWriter
+	gate bool
+
+	floor  float64 // dBFS, noise estimation
+	hang   time.Duration
+	speech bool
+
+	stats VadStats
+}
+
+func newVad(dest idleWriter, gate bool) *vad {
+	return &vad{dest: dest, gate: gate, floor: vadMinDb}
+}
+
+func (v *vad) WriteChunk(media time.Duration, pcm []byte) error {
+	speech := v.classify(pcm)
+	if speech || !v.gate {
+		return v.dest.WriteChunk(media, pcm)
+	}
+	return v.dest.WriteIdle(media, pcm)
+}
+
+// classify() updates the noise floor; speech lasts vadHangover after the level drops
+func (v *vad) classify(pcm []byte) (speech bool) {
+	db, zcr := levels(pcm)
+	d := time.Duration(len(pcm)/pcmBytesPerMs) * time.Millisecond
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if db < v.floor {
+		v.floor = db
+	} else {
+		v.floor += (db - v.floor) * vadFloorUp
+	}
+	if v.floor < vadMinDb-20 {
+		v.floor = vadMinDb - 20
+	}
+
+	active := db > vadMinDb && db > v.floor+vadMarginDb && zcr < vadMaxZcr
+	switch {
+	case active:
+		v.hang = vadHangover
+		speech = true
+	case v.speech && v.hang > 0:
+		v.hang -= d
+		speech = true
+	}
+	v.speech = speech
+
+	if speech {
+		v.stats.Speech++
+	} else {
+		v.stats.Silence++
+	}
+	return
+}
+
+func (v *vad) Stats() (s VadStats) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	s = v.stats
+	if n := s.Speech + s.Silence; n > 0 {
+		s.Ratio = float64(s.Speech) / float64(n)
+	}
+	return
+}
+
+// levels() computes rms in dBFS and zero crossings per sample of 16 bit le pcm
+func levels(pcm []byte) (db float64, zcr float64) {
+	n := len(pcm) / 2
+	if n == 0 {
+		return math.Inf(-1), 0
+	}
+	var sum float64
+	var crossings int
+	var prev int16
+	for i := 0; i < n; i++ {
+		s := int16(binary.LittleEndian.Uint16(pcm[2*i:]))
+		sum += float64(s) * float64(s)
+		if i > 0 && (s >= 0) != (prev >= 0) {
+			crossings++
+		}
+		prev = s
+	}
+	rms := math.Sqrt(sum/float64(n)) / 32768
+	db = 20 * math.Log10(rms)
+	zcr = float64(crossings) / float64(n)
+	return
+}
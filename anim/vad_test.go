@@ -0,0 +1,72 @@
+package anim
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+type gated struct {
+	chunks
+	idle int
+}
+
+func (g *gated) WriteIdle(media time.Duration, pcm []byte) error {
+	g.idle++
+	return nil
+}
+
+// tone() makes a chunk of 50ms sine, amplitude of full scale
+func tone(hz float64, amp float64) []byte {
+	b := make([]byte, 50*pcmBytesPerMs)
+	for i := 0; i < len(b)/2; i++ {
+		s := amp * 32767 * math.Sin(2*math.Pi*hz*float64(i)/voskRate)
+		binary.LittleEndian.PutUint16(b[2*i:], uint16(int16(s)))
+	}
+	return b
+}
+
+func TestVad(t *testing.T) {
+	dest := &gated{}
+	v := newVad(dest, true)
+
+	quiet := tone(200, 0.001) // -63 dBFS
+	loud := tone(200, 0.3)
+
+	var media time.Duration
+	write := func(pcm []byte, n int) {
+		for i := 0; i < n; i++ {
+			v.WriteChunk(media, pcm)
+			media += 50 * time.Millisecond
+		}
+	}
+	write(quiet, 10)
+	if dest.idle != 10 || len(dest.pcm) != 0 {
+		t.Fatal("silence is sent", dest.idle, len(dest.pcm))
+	}
+	write(loud, 10)
+	write(quiet, 10)
+	// 10 speech chunks, 300 ms of hangover
+	if len(dest.pcm) != 10+6 || dest.idle != 20-6 {
+		t.Fatal("unexpected speech", len(dest.pcm), dest.idle)
+	}
+	if s := v.Stats(); s.Speech != 16 || s.Silence != 14 || math.Abs(s.Ratio-16.0/30) > 1e-9 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	// white-ish noise is not speech
+	noise := tone(7900, 0.3)
+	if v.classify(noise) {
+		t.Fatal("noise is speech")
+	}
+}
+
+func TestVadNoGate(t *testing.T) {
+	dest := &gated{}
+	v := newVad(dest, false)
+	v.WriteChunk(0, tone(200, 0))
+	if dest.idle != 0 || len(dest.pcm) != 1 {
+		t.Fatal("silence is gated")
+	}
+}
@@ -0,0 +1,223 @@
+package anim
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dmisol/animportal/defs"
+	"github.com/dmisol/animportal/wire"
+)
+
+const (
+	defVisemeModel = "formant"
+	visemeFrame    = 20 // ms, analysis window
+
+	visemeType = "viseme"
+)
+
+var (
+	ErrVisemeModel = errors.New("Unknown viseme model")
+
+	visemeMu     sync.Mutex
+	visemeModels = map[string]func() VisemeModel{
+		defVisemeModel: newFormantModel,
+	}
+)
+
+// VisemeModel derives visemes from 16 kHz 16 bit mono pcm, one instance per session
+// Time of visemes is relative to the pcm start
+type VisemeModel interface {
+	Visemes(pcm []byte) []*defs.Viseme
+}
+
+// RegisterVisemeModel() makes the model available by name for PortalConf.VisemeModel
+func RegisterVisemeModel(name string, f func() VisemeModel) {
+	visemeMu.Lock()
+	defer visemeMu.Unlock()
+
+	visemeModels[name] = f
+}
+
+func newVisemeModel(name string) (m VisemeModel, err error) {
+	visemeMu.Lock()
+	defer visemeMu.Unlock()
+
+	f, ok := visemeModels[name]
+	if !ok {
+		err = fmt.Errorf("%w: %s", ErrVisemeModel, name)
+		return
+	}
+	m = f()
+	return
+}
+
+// animWriter may send phones for pcm
+type animWriter interface {
+	idleWriter
+	WriteAnim(a *defs.Anim, pcm []byte) error
+}
+
+// visemes sends phones derived from speech chunks, with or instead of pcm
+// vad -> visemes -> animation
+// old servers get pcm only
+type visemes struct {
+	dest  animWriter
+	model VisemeModel
+	only  bool
+
+	off bool // the server does not support phones
+}
+
+func newVisemes(dest animWriter, model VisemeModel, only bool) *visemes {
+	return &visemes{dest: dest, model: model, only: only}
+}
+
+func (v *visemes) WriteChunk(media time.Duration, pcm []byte) (err error) {
+	if v.off {
+		return v.dest.WriteChunk(media, pcm)
+	}
+	if !v.only {
+		if err = v.dest.WriteChunk(media, pcm); err != nil {
+			return
+		}
+	}
+
+	ts := int(media.Milliseconds())
+	phones := v.model.Visemes(pcm)
+	for _, p := range phones {
+		p.Time += ts
+	}
+	a := &defs.Anim{Ts: ts, Phones: phones}
+	if v.only {
+		err = v.dest.WriteAnim(a, pcm)
+	} else {
+		err = v.dest.WriteAnim(a, nil)
+	}
+	if errors.Is(err, wire.ErrVersion) {
+		v.off = true
+		if v.only {
+			err = v.dest.WriteChunk(media, pcm)
+		} else {
+			err = nil
+		}
+	}
+	return
+}
+
+func (v *visemes) WriteIdle(media time.Duration, pcm []byte) error {
+	return v.dest.WriteIdle(media, pcm)
+}
+
+func (v *visemes) WriteAnim(a *defs.Anim, pcm []byte) error {
+	return v.dest.WriteAnim(a, pcm)
+}
+
+// formantModel is a lightweight classifier: energy and zero crossings
+// tell silence, closed lips and fricatives; first two formants tell vowels
+type formantModel struct {
+	f1 []float64 // Hz, candidates
+	f2 []float64
+}
+
+// vowels by F1, F2, Hz
+var vowels = []struct {
+	value  string
+	f1, f2 float64
+}{
+	{"I", 300, 2300},
+	{"E", 500, 1900},
+	{"aa", 750, 1250},
+	{"O", 500, 900},
+	{"U", 320, 850},
+}
+
+func newFormantModel() VisemeModel {
+	m := &formantModel{}
+	for f := 250.0; f <= 900; f += 50 {
+		m.f1 = append(m.f1, f)
+	}
+	for f := 800.0; f <= 2500; f += 100 {
+		m.f2 = append(m.f2, f)
+	}
+	return m
+}
+
+func (m *formantModel) Visemes(pcm []byte) (phones []*defs.Viseme) {
+	step := visemeFrame * pcmBytesPerMs
+	for off := 0; off < len(pcm); off += step {
+		frame := pcm[off:]
+		if len(frame) > step {
+			frame = frame[:step]
+		}
+		d := len(frame) / pcmBytesPerMs
+		if d == 0 {
+			break
+		}
+		value := m.classify(frame)
+		if n := len(phones); n > 0 && phones[n-1].Value == value {
+			phones[n-1].Duration += d
+			continue
+		}
+		phones = append(phones, &defs.Viseme{
+			Time:     off / pcmBytesPerMs,
+			Type:     visemeType,
+			Value:    value,
+			Duration: d,
+		})
+	}
+	return
+}
+
+func (m *formantModel) classify(frame []byte) string {
+	db, zcr := levels(frame)
+	switch {
+	case db < vadMinDb+10:
+		return "sil"
+	case zcr > 0.25:
+		return "SS"
+	case db < vadMinDb+20:
+		return "PP"
+	}
+
+	x := make([]float64, len(frame)/2)
+	for i := range x {
+		hann := 0.5 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(len(x)-1))
+		x[i] = float64(int16(binary.LittleEndian.Uint16(frame[2*i:]))) * hann
+	}
+	f1 := peak(x, m.f1, 0)
+	f2 := peak(x, m.f2, f1+200)
+
+	best, dist := "", math.Inf(1)
+	for _, v := range vowels {
+		// distances in octaves
+		d := math.Pow(math.Log2(f1/v.f1), 2) + math.Pow(math.Log2(f2/v.f2), 2)
+		if d < dist {
+			best, dist = v.value, d
+		}
+	}
+	return best
+}
+
+// peak() returns the frequency above min with the most power, goertzel algorithm
+func peak(x []float64, freqs []float64, min float64) (f float64) {
+	f = math.Max(min, freqs[0])
+	max := -1.0
+	for _, fr := range freqs {
+		if fr < min {
+			continue
+		}
+		coef := 2 * math.Cos(2*math.Pi*fr/voskRate)
+		var s1, s2 float64
+		for _, v := range x {
+			s1, s2 = v+coef*s1-s2, s1
+		}
+		if p := s1*s1 + s2*s2 - coef*s1*s2; p > max {
+			max, f = p, fr
+		}
+	}
+	return
+}
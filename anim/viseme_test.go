@@ -0,0 +1,88 @@
+package anim
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/dmisol/animportal/defs"
+	"github.com/dmisol/animportal/wire"
+)
+
+type phones struct {
+	gated
+	anims []*defs.Anim
+	old   bool
+}
+
+func (p *phones) WriteAnim(a *defs.Anim, pcm []byte) error {
+	if p.old {
+		return wire.ErrVersion
+	}
+	p.anims = append(p.anims, a)
+	return nil
+}
+
+// vowel() makes a chunk of 50ms with two formants
+func vowel(f1 float64, f2 float64) []byte {
+	b := make([]byte, 50*pcmBytesPerMs)
+	for i := 0; i < len(b)/2; i++ {
+		t := float64(i) / voskRate
+		s := 0.3*math.Sin(2*math.Pi*f1*t) + 0.2*math.Sin(2*math.Pi*f2*t)
+		binary.LittleEndian.PutUint16(b[2*i:], uint16(int16(s*32767)))
+	}
+	return b
+}
+
+func TestFormantModel(t *testing.T) {
+	m, err := newVisemeModel(defVisemeModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range vowels {
+		ph := m.Visemes(vowel(v.f1, v.f2))
+		if len(ph) != 1 || ph[0].Value != v.value || ph[0].Duration != 50 {
+			t.Fatal("unexpected phones for", v.value, ph[0].Value, len(ph))
+		}
+	}
+	ph := m.Visemes(append(tone(200, 0)[:40*pcmBytesPerMs], vowel(750, 1250)...))
+	if len(ph) != 2 || ph[0].Value != "sil" || ph[1].Value != "aa" || ph[1].Time != 40 {
+		t.Fatal("unexpected phones", len(ph))
+	}
+	if ph := m.Visemes(tone(7000, 0.3)); ph[0].Value != "SS" {
+		t.Fatal("unexpected fricative", ph[0].Value)
+	}
+
+	if _, err = newVisemeModel("nope"); !errors.Is(err, ErrVisemeModel) {
+		t.Fatal("ErrVisemeModel expected, got", err)
+	}
+}
+
+func TestVisemes(t *testing.T) {
+	dest := &phones{}
+	m, _ := newVisemeModel(defVisemeModel)
+
+	v := newVisemes(dest, m, true)
+	v.WriteChunk(time.Second, vowel(300, 2300))
+	if len(dest.pcm) != 0 || len(dest.anims) != 1 {
+		t.Fatal("pcm is sent", len(dest.pcm), len(dest.anims))
+	}
+	if a := dest.anims[0]; a.Ts != 1000 || a.Phones[0].Time != 1000 || a.Phones[0].Value != "I" {
+		t.Fatal("unexpected anim", a.Ts, a.Phones[0].Time, a.Phones[0].Value)
+	}
+
+	v = newVisemes(dest, m, false)
+	v.WriteChunk(0, vowel(300, 2300))
+	if len(dest.pcm) != 1 || len(dest.anims) != 2 {
+		t.Fatal("pcm is not sent", len(dest.pcm), len(dest.anims))
+	}
+
+	// old server
+	dest = &phones{old: true}
+	v = newVisemes(dest, m, true)
+	if err := v.WriteChunk(0, vowel(300, 2300)); err != nil || len(dest.pcm) != 1 || !v.off {
+		t.Fatal("no fallback to pcm", err)
+	}
+}
@@ -0,0 +1,137 @@
+package anim
+
+// #cgo linux LDFLAGS: -lvpx
+// #include <stdlib.h>
+// #include <vpx/vpx_encoder.h>
+// #include <vpx/vp8cx.h>
+//
+// static vpx_codec_err_t vpx_open(vpx_codec_ctx_t *ctx, int vp9, int w, int h, int fps, int kbps) {
+// 	vpx_codec_iface_t *iface = vp9 ? vpx_codec_vp9_cx() : vpx_codec_vp8_cx();
+// 	vpx_codec_enc_cfg_t cfg;
+// 	vpx_codec_err_t err = vpx_codec_enc_config_default(iface, &cfg, 0);
+// 	if (err != VPX_CODEC_OK) {
+// 		return err;
+// 	}
+// 	cfg.g_w = w;
+// 	cfg.g_h = h;
+// 	cfg.g_timebase.num = 1;
+// 	cfg.g_timebase.den = fps;
+// 	cfg.g_threads = 2;
+// 	cfg.g_lag_in_frames = 0;
+// 	cfg.g_error_resilient = VPX_ERROR_RESILIENT_DEFAULT;
+// 	cfg.rc_end_usage = VPX_CBR;
+// 	cfg.rc_target_bitrate = kbps;
+// 	cfg.kf_mode = VPX_KF_AUTO;
+// 	cfg.kf_max_dist = 2 * fps;
+// 	if ((err = vpx_codec_enc_init(ctx, iface, &cfg, 0)) != VPX_CODEC_OK) {
+// 		return err;
+// 	}
+// 	return vpx_codec_control(ctx, VP8E_SET_CPUUSED, vp9 ? 7 : 10);
+// }
+//
+// static const void *vpx_pkt_buf(const vpx_codec_cx_pkt_t *pkt) { return pkt->data.frame.buf; }
+// static size_t vpx_pkt_sz(const vpx_codec_cx_pkt_t *pkt) { return pkt->data.frame.sz; }
+// static int vpx_pkt_is_frame(const vpx_codec_cx_pkt_t *pkt) { return pkt->kind == VPX_CODEC_CX_FRAME_PKT; }
+import "C"
+import (
+	"fmt"
+	"image"
+	"io"
+	"unsafe"
+)
+
+const (
+	fourccVP8 = "VP80"
+	fourccVP9 = "VP90"
+)
+
+// vpxEncoder produces VP8 or VP9 frames in ivf container
+type vpxEncoder struct {
+	w    io.Writer
+	ctx  *C.vpx_codec_ctx_t
+	img  *C.vpx_image_t
+	buf  unsafe.Pointer
+	pts  int64
+	W, H int
+}
+
+func newVpxEncoder(w io.Writer, vp9 bool, width int, height int, fps int, kbps int) (v *vpxEncoder, err error) {
+	if fps <= 0 {
+		fps = 24
+	}
+	v = &vpxEncoder{w: w, W: width, H: height}
+	v.ctx = (*C.vpx_codec_ctx_t)(C.calloc(1, C.size_t(unsafe.Sizeof(C.vpx_codec_ctx_t{}))))
+
+	x := C.int(0)
+	if vp9 {
+		x = 1
+	}
+	if e := C.vpx_open(v.ctx, x, C.int(width), C.int(height), C.int(fps), C.int(kbps)); e != C.VPX_CODEC_OK {
+		C.free(unsafe.Pointer(v.ctx))
+		err = fmt.Errorf("vpx init: %s", C.GoString(C.vpx_codec_err_to_string(e)))
+		return
+	}
+
+	// even dimensions are enough for 4:2:0
+	sz := (width + 1) / 2 * 2 * ((height + 1) / 2 * 2) * 3 / 2
+	v.buf = C.malloc(C.size_t(sz))
+	v.img = C.vpx_img_wrap(nil, C.VPX_IMG_FMT_I420, C.uint(width), C.uint(height), 1, (*C.uchar)(v.buf))
+
+	fourcc := fourccVP8
+	if vp9 {
+		fourcc = fourccVP9
+	}
+	_, err = v.w.Write(ivfHeader(fourcc, width, height, fps))
+	return
+}
+
+func (v *vpxEncoder) Encode(img image.Image) (err error) {
+	if r := img.Bounds(); r.Dx() != v.W || r.Dy() != v.H {
+		err = fmt.Errorf("vpx: image %dx%d, expected %dx%d", r.Dx(), r.Dy(), v.W, v.H)
+		return
+	}
+	yuv := toI420(img)
+	copyPlane(v.img.planes[0], int(v.img.stride[0]), yuv.Y, yuv.YStride, v.W, v.H)
+	cw, ch := (v.W+1)/2, (v.H+1)/2
+	copyPlane(v.img.planes[1], int(v.img.stride[1]), yuv.Cb, yuv.CStride, cw, ch)
+	copyPlane(v.img.planes[2], int(v.img.stride[2]), yuv.Cr, yuv.CStride, cw, ch)
+
+	if e := C.vpx_codec_encode(v.ctx, v.img, C.vpx_codec_pts_t(v.pts), 1, 0, C.VPX_DL_REALTIME); e != C.VPX_CODEC_OK {
+		err = fmt.Errorf("vpx encode: %s", C.GoString(C.vpx_codec_err_to_string(e)))
+		return
+	}
+	pts := v.pts
+	v.pts++
+
+	var iter C.vpx_codec_iter_t
+	for {
+		pkt := C.vpx_codec_get_cx_data(v.ctx, &iter)
+		if pkt == nil {
+			break
+		}
+		if C.vpx_pkt_is_frame(pkt) == 0 {
+			continue
+		}
+		frame := C.GoBytes(C.vpx_pkt_buf(pkt), C.int(C.vpx_pkt_sz(pkt)))
+		if _, err = v.w.Write(ivfFrame(uint64(pts), frame)); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (v *vpxEncoder) Close() (err error) {
+	C.vpx_img_free(v.img)
+	C.free(v.buf)
+	C.vpx_codec_destroy(v.ctx)
+	C.free(unsafe.Pointer(v.ctx))
+	return
+}
+
+// copyPlane() copies w x h bytes, row by row, to C memory
+func copyPlane(dst *C.uchar, dstStride int, src []byte, srcStride int, w int, h int) {
+	d := unsafe.Slice((*byte)(unsafe.Pointer(dst)), dstStride*h)
+	for y := 0; y < h; y++ {
+		copy(d[y*dstStride:y*dstStride+w], src[y*srcStride:y*srcStride+w])
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/dmisol/animportal"
+	"github.com/valyala/fasthttp"
+)
+
+var (
+	conf = flag.String("conf", "portal.yaml", "portal config (yaml)")
+	addr = flag.String("addr", ":8080", "http listen address")
+)
+
+func main() {
+	flag.Parse()
+
+	ap, err := animportal.NewPortal(*conf)
+	if err != nil {
+		log.Println("config", *conf, err)
+		os.Exit(1)
+	}
+
+	srv := &fasthttp.Server{
+		Name:    "animportal",
+		Handler: router(ap),
+	}
+
+	go func() {
+		log.Println("listening", *addr)
+		if err := srv.ListenAndServe(*addr); err != nil {
+			log.Println("listen", err)
+			os.Exit(1)
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	log.Println("signal", <-sig)
+
+	if err = srv.Shutdown(); err != nil {
+		log.Println("shutdown", err)
+	}
+	ap.Close()
+	log.Println("stopped")
+}
+
+func router(ap *animportal.AnimationPortal) fasthttp.RequestHandler {
+	return func(r *fasthttp.RequestCtx) {
+		p := string(r.Path())
+		switch {
+		case p == "/animate":
+			ap.Handler(r)
+		case p == "/sessions" || strings.HasPrefix(p, "/sessions/"):
+			ap.SessionsHandler(r)
+		case p == "/ramdisk":
+			ap.RamHandler(r)
+		case p == "/servers":
+			ap.ServersHandler(r)
+		default:
+			r.Error("not found", fasthttp.StatusNotFound)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package animportal
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/dmisol/animportal/defs"
+	"github.com/livekit/protocol/livekit"
+	lksdk "github.com/livekit/server-sdk-go"
+)
+
+// commands the owner sends over the data channel of the dummy room
+const (
+	cmdExpression = "expression" // control: defs.Control
+	cmdFtar       = "ftar"       // ftar: file name
+	cmdPause      = "pause"
+	cmdResume     = "resume"
+	cmdMute       = "mute"
+	cmdUnmute     = "unmute"
+)
+
+var (
+	errNotOwner = errors.New("not allowed")
+	errCommand  = errors.New("unknown command")
+)
+
+type command struct {
+	Id      string        `json:"id,omitempty"` // echoed in the ack
+	Cmd     string        `json:"cmd"`
+	Control *defs.Control `json:"control,omitempty"`
+	Ftar    string        `json:"ftar,omitempty"`
+}
+
+type commandAck struct {
+	Id    string `json:"id,omitempty"`
+	Cmd   string `json:"cmd"`
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// onData() executes the command and acks it to the sender only
+func (u *user) onData(data []byte, rp *lksdk.RemoteParticipant) {
+	ack := u.command(data, rp.Identity())
+	b, err := json.Marshal(ack)
+	if err != nil {
+		return
+	}
+	if err = u.Dummy.LocalParticipant.PublishData(b, livekit.DataPacket_RELIABLE, []string{rp.SID()}); err != nil {
+		u.Println("ack", ack.Cmd, err)
+	}
+}
+
+func (u *user) command(data []byte, from string) (ack *commandAck) {
+	ack = &commandAck{}
+	c := &command{}
+	err := json.Unmarshal(data, c)
+	if err == nil {
+		ack.Id, ack.Cmd = c.Id, c.Cmd
+		err = u.execute(c, from)
+	}
+	if err != nil {
+		ack.Error = err.Error()
+	} else {
+		ack.Ok = true
+	}
+	return
+}
+
+func (u *user) execute(c *command, from string) error {
+	if from != u.Owner {
+		return errNotOwner
+	}
+	switch c.Cmd {
+	case cmdExpression:
+		if c.Control == nil {
+			c.Control = &defs.Control{}
+		}
+		return u.applyControl(c.Control)
+	case cmdFtar:
+		return u.applyControl(&defs.Control{Ftar: c.Ftar})
+	case cmdPause, cmdResume, cmdMute, cmdUnmute:
+	default:
+		return errCommand
+	}
+
+	if u.Engine == nil {
+		return errNoEngine
+	}
+	switch c.Cmd {
+	case cmdPause, cmdResume:
+		u.Engine.Pause(c.Cmd == cmdPause)
+	case cmdMute, cmdUnmute:
+		u.Engine.Mute(c.Cmd == cmdMute)
+	}
+	u.Println(c.Cmd, "by", from)
+	return nil
+}
@@ -0,0 +1,27 @@
+package animportal
+
+import (
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	u := &user{Owner: "bob"}
+
+	for _, c := range []struct {
+		data, from, err string
+	}{
+		{`{"id": "1", "cmd": "pause"}`, "eve", errNotOwner.Error()},
+		{`{"id": "2", "cmd": "dance"}`, "bob", errCommand.Error()},
+		{`{"id": "3", "cmd": "mute"}`, "bob", errNoEngine.Error()},
+		{`{"id": "4", "cmd": "ftar", "ftar": "x.ftar"}`, "bob", errNoEngine.Error()},
+		{`{"id": "5", "cmd": "expression", "control": {"hat": true}}`, "bob", errNoEngine.Error()},
+	} {
+		ack := u.command([]byte(c.data), c.from)
+		if ack.Ok || ack.Error != c.err || ack.Id == "" {
+			t.Fatalf("unexpected ack %+v for %s", ack, c.data)
+		}
+	}
+	if ack := u.command([]byte(`nonsense`), "bob"); ack.Ok || ack.Error == "" {
+		t.Fatal("error expected")
+	}
+}
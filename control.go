@@ -0,0 +1,166 @@
+package animportal
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/dmisol/animportal/anim"
+	"github.com/dmisol/animportal/defs"
+	"github.com/dmisol/animportal/wire"
+	"github.com/gorilla/websocket"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+)
+
+type controlReply struct {
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// POST /sessions/{id}/control with defs.Control
+// GET  /sessions/{id}/control upgrades to websocket, defs.Control per message, controlReply per each
+func (u *user) control(r *fasthttp.RequestCtx) {
+	switch {
+	case r.IsPost():
+		c := &defs.Control{}
+		if err := json.Unmarshal(r.PostBody(), c); err != nil {
+			writeError(r, fasthttp.StatusBadRequest, "bad json")
+			return
+		}
+		if err := u.applyControl(c); err != nil {
+			writeError(r, controlStatus(err), err.Error())
+			return
+		}
+		r.SetStatusCode(fasthttp.StatusNoContent)
+	case r.IsGet():
+		upgrade(r, u.controlWs)
+	default:
+		writeError(r, fasthttp.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (u *user) controlWs(ws *websocket.Conn) {
+	// session is over, the client is to know
+	quit, watched := make(chan struct{}), make(chan struct{})
+	defer func() {
+		// the watcher is not to touch the conn once fasthttp takes it back
+		close(quit)
+		<-watched
+		ws.Close()
+	}()
+	go func() {
+		defer close(watched)
+		select {
+		case <-u.Done():
+			// closing hijacked conn is up to fasthttp, reading is to stop
+			ws.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "session closed"), time.Now().Add(time.Second))
+			ws.SetReadDeadline(time.Now())
+		case <-quit:
+		}
+	}()
+
+	for {
+		_, b, err := ws.ReadMessage()
+		if err != nil {
+			return
+		}
+		reply := &controlReply{Ok: true}
+		c := &defs.Control{}
+		if err = json.Unmarshal(b, c); err == nil {
+			err = u.applyControl(c)
+		}
+		if err != nil {
+			reply = &controlReply{Error: err.Error()}
+		}
+		if err = ws.WriteJSON(reply); err != nil {
+			return
+		}
+	}
+}
+
+func (u *user) applyControl(c *defs.Control) (err error) {
+	if u.Engine == nil {
+		return errNoEngine
+	}
+	if c.Ftar != "" {
+		// same folder as the default one, like /animate?ftar=
+		c.Ftar = path.Join(path.Dir(u.conf.DefaultFtar), path.Clean("/"+c.Ftar))
+	}
+	if err = u.Engine.Control(c); err == nil && c.Ftar != "" {
+		u.mu.Lock()
+		u.ftar = c.Ftar
+		u.mu.Unlock()
+	}
+	return
+}
+
+var errNoEngine = errors.New("no engine")
+
+func controlStatus(err error) int {
+	switch {
+	case errors.Is(err, anim.ErrControl):
+		return fasthttp.StatusBadRequest
+	case errors.Is(err, wire.ErrVersion):
+		return fasthttp.StatusNotImplemented
+	case errors.Is(err, errNoEngine):
+		return fasthttp.StatusServiceUnavailable
+	}
+	return fasthttp.StatusBadGateway
+}
+
+// upgrade() hands the connection over to gorilla, once fasthttp lets it go
+func upgrade(r *fasthttp.RequestCtx, handler func(ws *websocket.Conn)) {
+	req := &http.Request{}
+	if err := fasthttpadaptor.ConvertRequest(r, req, true); err != nil {
+		writeError(r, fasthttp.StatusBadRequest, "bad request")
+		return
+	}
+	if !websocket.IsWebSocketUpgrade(req) {
+		writeError(r, fasthttp.StatusBadRequest, "websocket expected")
+		return
+	}
+	r.HijackSetNoResponse(true)
+	r.Hijack(func(c net.Conn) {
+		up := websocket.Upgrader{CheckOrigin: func(*http.Request) bool { return true }}
+		ws, err := up.Upgrade(&hijacked{Conn: c, h: make(http.Header)}, req, nil)
+		if err != nil {
+			return
+		}
+		handler(ws)
+	})
+}
+
+// hijacked is http.ResponseWriter and http.Hijacker for gorilla Upgrader
+type hijacked struct {
+	net.Conn
+	h      http.Header
+	status int
+}
+
+func (h *hijacked) Header() http.Header {
+	return h.h
+}
+
+// Write() is used by Upgrader to report errors
+func (h *hijacked) Write(b []byte) (int, error) {
+	if h.status == 0 {
+		h.WriteHeader(http.StatusOK)
+	}
+	return h.Conn.Write(b)
+}
+
+func (h *hijacked) WriteHeader(status int) {
+	h.status = status
+	resp := &http.Response{StatusCode: status, ProtoMajor: 1, ProtoMinor: 1, Header: h.h}
+	h.h.Set("Connection", "close")
+	resp.Write(h.Conn)
+}
+
+func (h *hijacked) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return h.Conn, bufio.NewReadWriter(bufio.NewReader(h.Conn), bufio.NewWriter(h.Conn)), nil
+}
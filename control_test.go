@@ -0,0 +1,65 @@
+package animportal
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttputil"
+)
+
+func TestControl(t *testing.T) {
+	ap := &AnimationPortal{sessions: make(map[string]*user)}
+	u := &user{room: "abc", Owner: "bob", t0: time.Now()}
+	u.Context, u.CancelFunc = context.WithCancel(context.Background())
+	ap.register(u)
+
+	post := func(body string) int {
+		r := &fasthttp.RequestCtx{}
+		r.Request.Header.SetMethod(fasthttp.MethodPost)
+		r.Request.SetRequestURI("/sessions/abc/control")
+		r.Request.SetBodyString(body)
+		ap.SessionsHandler(r)
+		return r.Response.StatusCode()
+	}
+	if status := post(`{"pattern_index": "x"}`); status != fasthttp.StatusBadRequest {
+		t.Fatal("expected 400, got", status)
+	}
+	if status := post(`{"pattern_index": 2}`); status != fasthttp.StatusServiceUnavailable {
+		t.Fatal("expected 503, got", status)
+	}
+
+	ln := fasthttputil.NewInmemoryListener()
+	defer ln.Close()
+	go fasthttp.Serve(ln, ap.SessionsHandler)
+
+	dialer := websocket.Dialer{NetDial: func(string, string) (net.Conn, error) { return ln.Dial() }}
+	ws, _, err := dialer.Dial("ws://portal/sessions/abc/control", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+
+	for _, msg := range []string{`{"hat": true}`, `nonsense`} {
+		if err = ws.WriteMessage(websocket.TextMessage, []byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+		reply := &controlReply{}
+		if err = ws.ReadJSON(reply); err != nil {
+			t.Fatal(err)
+		}
+		if reply.Ok || reply.Error == "" {
+			t.Fatal("error expected for", msg)
+		}
+	}
+
+	// session is over
+	u.CancelFunc()
+	ws.SetReadDeadline(time.Now().Add(time.Second))
+	if _, _, err = ws.ReadMessage(); err == nil {
+		t.Fatal("ws is not closed")
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"time"
 
 	"github.com/dmisol/animportal/defs"
+	"github.com/dmisol/animportal/wire"
 	"gocv.io/x/gocv"
 )
 
@@ -38,27 +39,37 @@ func main() {
 	}
 }
 
-func handler(conn net.Conn) {
+func handler(c net.Conn) {
+	conn := wire.NewConn(c)
 	defer conn.Close()
 
-	buf := make([]byte, 2048)
+	if err := conn.Accept(); err != nil {
+		log.Println("hello:", err)
+		return
+	}
+	log.Println("protocol version", conn.Version)
+
 	// initial json
-	if _, err := conn.Read(buf); err != nil {
+	m, err := conn.Recv()
+	if err != nil {
 		log.Println("reading:", err.Error())
 		return
 	}
-	var init *defs.InitialJson
-
-	log.Println("initial json read")
+	if m.Type != wire.Init {
+		log.Println("initial json expected, got", m.Type)
+		return
+	}
 
-	if err := json.Unmarshal(buf, init); err != nil {
+	init := &defs.InitialJson{}
+	if err := json.Unmarshal(m.Payload, init); err != nil {
 		log.Println("initial json", err)
+		conn.Send(wire.Error, []byte(err.Error()))
 		return
 	}
 
 	log.Println("unmarshalled")
 
-	var started chan bool
+	started := make(chan bool, 1)
 	go func() {
 		// wait for the first "audio" file
 		audio := <-started
@@ -71,8 +82,7 @@ func handler(conn net.Conn) {
 		if init.FPS != 0 {
 			fps = init.FPS
 		}
-		dt := 10000000000 / fps
-		t := time.NewTicker(time.Nanosecond * time.Duration(dt))
+		t := time.NewTicker(time.Second / time.Duration(fps))
 		defer t.Stop()
 
 		log.Println("image created")
@@ -82,7 +92,11 @@ func handler(conn net.Conn) {
 			name := fmt.Sprintf("%s/%d.png", init.Dir, index)
 			index++
 
-			if err := firePng(conn, &img, name); err != nil {
+			fire := firePng
+			if init.Inband {
+				fire = fireInband
+			}
+			if err := fire(conn, &img, name); err != nil {
 				log.Println("senging png", err)
 				return
 			}
@@ -91,36 +105,91 @@ func handler(conn net.Conn) {
 	}()
 
 	running := false
+	defer func() {
+		if !running {
+			started <- false
+		}
+	}()
 	for {
-		i, err := conn.Read(buf)
+		m, err := conn.Recv()
 		if err != nil {
 			log.Println("read", err)
-			if !running {
-				started <- false
-			}
 			return
 		}
-		if err = os.Remove(string(buf[:i])); err != nil {
-			log.Println("removing", err)
+		switch m.Type {
+		case wire.Audio, wire.Pcm:
+			data := m.Payload
+			if conn.Version >= wire.StampVersion {
+				var media time.Duration
+				if media, data, err = wire.DecodeChunk(m.Payload); err != nil {
+					log.Println("chunk", err)
+					return
+				}
+				log.Println(m.Type, "at", media)
+			}
+			if m.Type == wire.Audio {
+				if err = os.Remove(string(data)); err != nil {
+					log.Println("removing", err)
+					conn.Send(wire.Error, []byte(err.Error()))
+					return
+				}
+			}
 			if !running {
-				started <- false
+				log.Println("first audio")
+				started <- true
+				running = true
 			}
+		case wire.Idle:
+			media, d, err := wire.DecodeIdle(m.Payload)
+			log.Println("idle at", media, d, err)
+			if !running {
+				log.Println("first idle")
+				started <- true
+				running = true
+			}
+		case wire.Anim:
+			a := &defs.Anim{}
+			if err = json.Unmarshal(m.Payload, a); err != nil {
+				log.Println("anim", err)
+				return
+			}
+			for _, p := range a.Phones {
+				log.Println("phone", p.Time, p.Value, p.Duration)
+			}
+			if !running {
+				log.Println("first phones")
+				started <- true
+				running = true
+			}
+		case wire.Control:
+			log.Println("control", string(m.Payload))
+		case wire.Bye:
+			log.Println("bye")
 			return
-		}
-		if !running {
-			log.Println("first audio")
-			started <- true
-			running = true
+		default:
+			log.Println("unexpected", m.Type)
 		}
 	}
 }
 
-func firePng(c net.Conn, img *gocv.Mat, name string) (err error) {
+func firePng(c *wire.Conn, img *gocv.Mat, name string) (err error) {
 	gocv.PutText(img, time.Now().String(), image.Point{5, 5}, 0, 5.0, color.RGBA{0, 0, 255, 0}, 2)
 	if res := gocv.IMWrite(name, *img); !res {
 		err = errors.New("failed to write " + name)
 		return
 	}
-	_, err = c.Write([]byte(name))
+	err = c.Send(wire.Frame, []byte(name))
+	return
+}
+
+func fireInband(c *wire.Conn, img *gocv.Mat, name string) (err error) {
+	gocv.PutText(img, time.Now().String(), image.Point{5, 5}, 0, 5.0, color.RGBA{0, 0, 255, 0}, 2)
+	var buf *gocv.NativeByteBuffer
+	if buf, err = gocv.IMEncode(gocv.PNGFileExt, *img); err != nil {
+		return
+	}
+	defer buf.Close()
+
+	err = c.Send(wire.Image, wire.EncodeImage(wire.PNG, img.Cols(), img.Rows(), buf.GetBytes()))
 	return
 }
@@ -2,6 +2,10 @@ package defs
 
 const (
 	Port = 50000
+
+	CodecH264 = "h264"
+	CodecVP8  = "vp8"
+	CodecVP9  = "vp9"
 )
 
 type InitialJson struct {
@@ -23,6 +27,8 @@ type InitialJson struct {
 	Mask    int    `json:"merge_type,omitempty"`
 	Color   int    `json:"color_filter,omitempty"`
 	Pi      int    `json:"pattern_index,omitempty"`
+	Inband  bool   `json:"inband,omitempty"` // pcm and images are sent over the socket
+	Codec   string `json:"codec,omitempty"`  // video codec to publish flexatar with, CodecH264 if empty
 }
 
 type Anim struct {
@@ -41,3 +47,17 @@ type Viseme struct {
 	end      int
 	Duration int `json:"duration"` // ms
 }
+
+// Control changes the running animation, fields not set are left as is
+type Control struct {
+	Pattern []float64 `json:"pattern,omitempty"` // model params
+	Pi      *int      `json:"pattern_index,omitempty"`
+	Glasses *bool     `json:"glasses,omitempty"`
+	Hat     *bool     `json:"hat,omitempty"`
+	Color   *int      `json:"color_filter,omitempty"`
+	Ftar    string    `json:"ftar,omitempty"` // another flexatar file
+}
+
+func (c *Control) Empty() bool {
+	return len(c.Pattern) == 0 && c.Pi == nil && c.Glasses == nil && c.Hat == nil && c.Color == nil && c.Ftar == ""
+}
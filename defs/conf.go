@@ -1,8 +1,48 @@
 package defs
 
+import "time"
+
+const (
+	TransportFile   = "file"   // pcm and images are shared via ramdisk, names go over the socket
+	TransportInband = "inband" // pcm and images go over the socket, server may run elsewhere
+
+	BalanceLeast    = "least"    // fewest sessions
+	BalanceWeighted = "weighted" // fewest sessions per weight
+)
+
+// AnimServer is one of the animation servers sessions are spread over
+type AnimServer struct {
+	Addr     string `yaml:"addr"`
+	Capacity int    `yaml:"capacity"` // sessions, 0 - unlimited
+	Weight   int    `yaml:"weight"`   // capacity, or 1 if 0
+}
+
 type PortalConf struct {
-	AnimAddr string `yaml:"anim"`
-	Ram      string `yaml:"ramdisk"`
+	AnimAddr  string `yaml:"anim"`
+	Ram       string `yaml:"ramdisk"`
+	Transport string `yaml:"transport"` // TransportFile if empty
+
+	AnimServers []AnimServer  `yaml:"anim_servers"` // AnimAddr is not used if set
+	Balance     string        `yaml:"anim_balance"` // BalanceLeast if empty
+	AnimCheck   time.Duration `yaml:"anim_check"`   // health check period, 10s if 0
+
+	MaxSessions int           `yaml:"max_sessions"`  // portal wide, 0 - unlimited
+	MaxPerOwner int           `yaml:"max_per_owner"` // sessions of the same name, 0 - unlimited
+	MaxPerHall  int           `yaml:"max_per_hall"`  // flexatars in the same hall, 0 - unlimited
+	RetryAfter  time.Duration `yaml:"retry_after"`   // suggested to the rejected, 30s if 0
+
+	RamMaxAge time.Duration `yaml:"ramdisk_max_age"` // orphaned folders are removed after
+	RamQuota  int64         `yaml:"ramdisk_quota"`   // bytes, 0 - unlimited
+
+	JitterDepth int           `yaml:"jitter_depth"` // owner's audio packets, default if 0
+	PcmChunk    time.Duration `yaml:"pcm_chunk"`    // sent for animation at once, 50ms if 0
+	Vad         bool          `yaml:"vad"`          // silence is sent as idle, not pcm
+	NoIdle      bool          `yaml:"no_idle"`      // no idle frames are requested while nothing is said
+	VisemeModel string        `yaml:"viseme_model"` // phones are derived and sent if set, e.g. "formant"
+	VisemeOnly  bool          `yaml:"viseme_only"`  // phones instead of pcm
+	Vosk        string        `yaml:"vosk"`         // vosk-server websocket url, recognized words are sent if set
+	Tts         string        `yaml:"tts"`          // "espeak-ng --stdout" or "file:/path.wav", see tts.New()
+	ScriptDir   string        `yaml:"script_dir"`   // audio files for scripts, playback is off if empty
 
 	Key    string `yaml:"key"`
 	Secret string `yaml:"secret"`
@@ -12,6 +52,7 @@ type PortalConf struct {
 
 	DefaultInitJson string `yaml:"initjson"`
 	DefaultFtar     string `yaml:"ftar"`
+	DefaultCodec    string `yaml:"codec"`
 
 	InitialJson
 }
@@ -5,6 +5,7 @@ go 1.18
 require (
 	github.com/gen2brain/x264-go v0.2.1
 	github.com/google/uuid v1.3.0
+	github.com/gorilla/websocket v1.4.2
 	github.com/livekit/protocol v0.13.3
 	github.com/livekit/server-sdk-go v0.10.4
 	github.com/pion/interceptor v0.1.11
@@ -30,7 +31,6 @@ require (
 	github.com/go-logr/stdr v1.0.0 // indirect
 	github.com/go-redis/redis/v8 v8.11.3 // indirect
 	github.com/golang/protobuf v1.5.2 // indirect
-	github.com/gorilla/websocket v1.4.2 // indirect
 	github.com/jxskiss/base62 v0.0.0-20191017122030-4f11678b909b // indirect
 	github.com/klauspost/compress v1.15.0 // indirect
 	github.com/lithammer/shortuuid/v3 v3.0.7 // indirect
@@ -0,0 +1,204 @@
+package animportal
+
+import (
+	"context"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+const (
+	janitorPeriod = time.Minute
+	defRamMaxAge  = 10 * time.Minute
+)
+
+// RamStats are exposed to the operator at /ramdisk
+type RamStats struct {
+	Dirs         int       `json:"dirs"`
+	Orphans      int       `json:"orphans"`
+	Bytes        int64     `json:"bytes"`
+	Quota        int64     `json:"quota,omitempty"`
+	RemovedDirs  int64     `json:"removed_dirs"`
+	RemovedBytes int64     `json:"removed_bytes"`
+	LastSweep    time.Time `json:"last_sweep"`
+}
+
+// janitor removes ramdisk folders left by crashed or abandoned sessions
+// and keeps the ramdisk below the quota
+type janitor struct {
+	dir    string
+	maxAge time.Duration
+	quota  int64           // bytes, 0 - unlimited
+	active func() []string // folders of the running sessions
+
+	mu    sync.Mutex
+	stats RamStats
+}
+
+type ramEntry struct {
+	path  string
+	size  int64
+	mtime time.Time
+}
+
+func newJanitor(dir string, maxAge time.Duration, quota int64, active func() []string) *janitor {
+	if maxAge == 0 {
+		maxAge = defRamMaxAge
+	}
+	return &janitor{
+		dir:    dir,
+		maxAge: maxAge,
+		quota:  quota,
+		active: active,
+	}
+}
+
+func (j *janitor) run(ctx context.Context) {
+	t := time.NewTicker(janitorPeriod)
+	defer t.Stop()
+
+	for {
+		j.sweep()
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (j *janitor) sweep() {
+	entries, err := os.ReadDir(j.dir)
+	if err != nil {
+		j.Println("readdir", err)
+		return
+	}
+
+	active := make(map[string]bool)
+	for _, d := range j.active() {
+		active[path.Clean(d)] = true
+	}
+
+	st := RamStats{Quota: j.quota}
+	var orphans []*ramEntry
+	now := time.Now()
+	for _, de := range entries {
+		if !de.IsDir() {
+			continue
+		}
+		e := measure(path.Join(j.dir, de.Name()))
+		st.Dirs++
+
+		if active[e.path] {
+			st.Bytes += e.size
+			continue
+		}
+		if now.Sub(e.mtime) > j.maxAge {
+			j.remove(&st, e)
+			continue
+		}
+		st.Bytes += e.size
+		st.Orphans++
+		orphans = append(orphans, e)
+	}
+
+	if j.quota > 0 && st.Bytes > j.quota {
+		// orphans go first, oldest first
+		sort.Slice(orphans, func(i, k int) bool { return orphans[i].mtime.Before(orphans[k].mtime) })
+		for _, e := range orphans {
+			if st.Bytes <= j.quota {
+				break
+			}
+			if e.size == 0 {
+				// nothing to gain, may belong to a session being set up
+				continue
+			}
+			j.remove(&st, e)
+			st.Orphans--
+			st.Bytes -= e.size
+		}
+	}
+	if j.quota > 0 && st.Bytes > j.quota {
+		// running sessions are never touched
+		j.Println("quota exceeded", st.Bytes, j.quota)
+	}
+	st.LastSweep = now
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	st.RemovedDirs += j.stats.RemovedDirs
+	st.RemovedBytes += j.stats.RemovedBytes
+	j.stats = st
+}
+
+func (j *janitor) remove(st *RamStats, e *ramEntry) {
+	if err := os.RemoveAll(e.path); err != nil {
+		j.Println("rm", e.path, err)
+		return
+	}
+	j.Println("removed orphan", e.path, e.size)
+	st.Dirs--
+	st.RemovedDirs++
+	st.RemovedBytes += e.size
+}
+
+func (j *janitor) Stats() RamStats {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	return j.stats
+}
+
+func (j *janitor) Println(i ...interface{}) {
+	log.Println("janitor", i)
+}
+
+// measure() returns total size and the latest modification time of the tree
+func measure(dir string) (e *ramEntry) {
+	e = &ramEntry{path: dir}
+	filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		fi, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			e.size += fi.Size()
+		}
+		if fi.ModTime().After(e.mtime) {
+			e.mtime = fi.ModTime()
+		}
+		return nil
+	})
+	return
+}
+
+// activeDirs() lists ramdisk folders of the running sessions
+func (ap *AnimationPortal) activeDirs() (dirs []string) {
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+
+	for _, u := range ap.sessions {
+		dirs = append(dirs, u.dirs...)
+	}
+	return
+}
+
+// GET /ramdisk
+func (ap *AnimationPortal) RamHandler(r *fasthttp.RequestCtx) {
+	if ap.janitor == nil {
+		writeError(r, fasthttp.StatusNotFound, "no ramdisk")
+		return
+	}
+	writeJson(r, fasthttp.StatusOK, ap.janitor.Stats())
+}
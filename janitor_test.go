@@ -0,0 +1,63 @@
+package animportal
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestJanitor(t *testing.T) {
+	ram := t.TempDir()
+	mk := func(name string, size int, age time.Duration) string {
+		d := path.Join(ram, name)
+		os.MkdirAll(d, 0777)
+		f := path.Join(d, "1.pcm")
+		os.WriteFile(f, make([]byte, size), 0666)
+		ts := time.Now().Add(-age)
+		os.Chtimes(f, ts, ts)
+		os.Chtimes(d, ts, ts)
+		return d
+	}
+	active := mk("active", 100, time.Hour)
+	stale := mk("stale", 100, time.Hour)
+	young := mk("young", 100, time.Second)
+
+	j := newJanitor(ram, time.Minute, 0, func() []string { return []string{active} })
+	j.sweep()
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatal("stale orphan not removed")
+	}
+	for _, d := range []string{active, young} {
+		if _, err := os.Stat(d); err != nil {
+			t.Fatal("removed", d)
+		}
+	}
+	if s := j.Stats(); s.Dirs != 2 || s.Orphans != 1 || s.RemovedDirs != 1 || s.Bytes != 200 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	// quota: young orphan goes, active session stays
+	j.quota = 150
+	j.sweep()
+	if _, err := os.Stat(young); !os.IsNotExist(err) {
+		t.Fatal("young orphan not removed over quota")
+	}
+	if _, err := os.Stat(active); err != nil {
+		t.Fatal("active removed")
+	}
+	if s := j.Stats(); s.Dirs != 1 || s.RemovedDirs != 2 || s.Bytes != 100 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+
+	// nothing but the active session over quota, kept as is
+	j.quota = 50
+	j.sweep()
+	if _, err := os.Stat(path.Join(active, "1.pcm")); err != nil {
+		t.Fatal("active session file removed")
+	}
+	if s := j.Stats(); s.Dirs != 1 || s.RemovedDirs != 2 || s.Bytes != 100 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
@@ -3,14 +3,17 @@ package animportal
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
 	"path"
+	"sync"
 	"sync/atomic"
 	"time"
 
+	"github.com/dmisol/animportal/anim"
 	"github.com/dmisol/animportal/defs"
 	"github.com/google/uuid"
 	"github.com/livekit/protocol/auth"
@@ -19,13 +22,30 @@ import (
 )
 
 const (
-	lifetime = 2 * time.Hour
-	initJson = "init.json"
+	lifetime     = 2 * time.Hour
+	setupTimeout = 20 * time.Second
+	initJson     = "init.json"
+)
+
+var (
+	ErrLivekit   = errors.New("LiveKit unreachable")
+	ErrTransport = errors.New("Unknown transport")
 )
 
 type AnimationPortal struct {
 	*defs.PortalConf
 	index int64
+
+	mu       sync.Mutex
+	sessions map[string]*user // active sessions, by dummy room
+	slots    slots            // admitted sessions, by owner and hall
+
+	janitor *janitor
+	pool    *anim.Pool // animation servers
+
+	context.Context
+	context.CancelFunc
+	wg sync.WaitGroup
 }
 
 func NewPortal(name string) (ap *AnimationPortal, err error) {
@@ -38,11 +58,21 @@ func NewPortal(name string) (ap *AnimationPortal, err error) {
 
 	ap = &AnimationPortal{
 		PortalConf: &defs.PortalConf{},
+		sessions:   make(map[string]*user),
 	}
+	ap.Context, ap.CancelFunc = context.WithCancel(context.Background())
 	if err = yaml.Unmarshal(cont, ap.PortalConf); err != nil {
 		log.Println("yaml err", name, err)
 		return
 	}
+	switch ap.PortalConf.Transport {
+	case "", defs.TransportFile, defs.TransportInband:
+	default:
+		// a typo would silently fall back to files the server may not reach
+		err = fmt.Errorf("%w: %q", ErrTransport, ap.PortalConf.Transport)
+		log.Println("yaml err", name, err)
+		return
+	}
 
 	jn := initJson
 	if len(ap.PortalConf.DefaultInitJson) > 0 {
@@ -57,12 +87,39 @@ func NewPortal(name string) (ap *AnimationPortal, err error) {
 		return
 	}
 	ap.PortalConf.InitialJson.Ftar = ap.PortalConf.DefaultFtar
+	if len(ap.PortalConf.DefaultCodec) > 0 {
+		ap.PortalConf.InitialJson.Codec = ap.PortalConf.DefaultCodec
+	}
+
+	ap.pool = anim.NewPool(*ap.PortalConf)
+	go ap.pool.Run(ap.Context)
+
+	if len(ap.PortalConf.Ram) > 0 {
+		ap.janitor = newJanitor(path.Clean(ap.PortalConf.Ram), ap.PortalConf.RamMaxAge, ap.PortalConf.RamQuota, ap.activeDirs)
+		go ap.janitor.run(ap.Context)
+	}
 	return
 }
 
+type animateReply struct {
+	Token   string `json:"token"`
+	Room    string `json:"room"`
+	Ws      string `json:"ws"`
+	Session string `json:"session"`
+}
+
+type errorReply struct {
+	Error string `json:"error"`
+}
+
+func writeError(r *fasthttp.RequestCtx, status int, msg string) {
+	writeJson(r, status, &errorReply{Error: msg})
+}
+
 // /animate?name=xxx
 // /animate?name=xxx&hall=yyy&ftar=zzz
 // if body exists, it contains alternative InitialJson
+// replies with animateReply once the session is ready, or 429 with Retry-After if over the caps
 func (ap *AnimationPortal) Handler(r *fasthttp.RequestCtx) {
 	name := string(r.FormValue("name"))
 	hall := string(r.FormValue("hall"))
@@ -71,19 +128,33 @@ func (ap *AnimationPortal) Handler(r *fasthttp.RequestCtx) {
 	dummy := uuid.NewString()
 
 	if name == "" {
-		r.Error("no name", fasthttp.StatusBadRequest)
+		writeError(r, fasthttp.StatusBadRequest, "no name")
 		return
 	}
 	if hall == "" {
 		hall = "ft"
 	}
 
+	// caps are checked before anything is set up
+	release, err := ap.admit(name, hall)
+	if err != nil {
+		log.Println("rejected", name, hall, err)
+		ap.reject(r, err)
+		return
+	}
+	admitted := false
+	defer func() {
+		if !admitted {
+			release()
+		}
+	}()
+
 	conf := *ap.PortalConf
 
 	body := r.Request.Body()
 	if len(body) > 0 {
 		if err := json.Unmarshal(body, &conf.InitialJson); err != nil {
-			r.Error("invalid body - initial json", fasthttp.StatusBadRequest)
+			writeError(r, fasthttp.StatusBadRequest, "invalid body - initial json")
 			return
 		}
 	}
@@ -92,32 +163,87 @@ func (ap *AnimationPortal) Handler(r *fasthttp.RequestCtx) {
 		conf.InitialJson.Ftar = path.Join(path.Dir(conf.DefaultFtar), ftar)
 	}
 
-	x := atomic.AddInt64(&ap.index, 1)
-	conf.InitialJson.Dir = fmt.Sprintf("%s/%d", conf.Ram, x)
-	if err := os.MkdirAll(conf.InitialJson.Dir, 0777); err != nil {
-		r.Error("can't create ramfs folder", fasthttp.StatusInternalServerError)
-		return
+	if conf.Transport != defs.TransportInband {
+		x := atomic.AddInt64(&ap.index, 1)
+		conf.InitialJson.Dir = fmt.Sprintf("%s/%d", conf.Ram, x)
+		if err := os.MkdirAll(conf.InitialJson.Dir, 0777); err != nil {
+			writeError(r, fasthttp.StatusInternalServerError, "can't create ramfs folder")
+			return
+		}
 	}
 
 	t, err := ap.signToken(lifetime, name, "", dummy)
 	if err != nil {
-		r.Error("can't make token", fasthttp.StatusInternalServerError)
+		writeError(r, fasthttp.StatusInternalServerError, "can't make token")
 		return
 	}
 
-	ctx, _ := context.WithTimeout(context.Background(), lifetime)
+	// the session lives in its own goroutine, the handler only waits till it is ready
+	ctx, cancel := context.WithTimeout(ap.Context, lifetime)
+	ready := make(chan error, 1)
+	ap.wg.Add(1)
+	admitted = true
 	go func() {
+		defer ap.wg.Done()
+		defer release()
+		defer cancel()
 
 		p, err := ap.newUser(ctx, hall, dummy, name, conf)
 		if err != nil {
-			r.Error("can't start portal", fasthttp.StatusInternalServerError)
+			ready <- err
 			return
 		}
-		r.WriteString(t)
+		ap.register(p)
+		defer ap.unregister(p)
+		ready <- nil
 
-		<-ctx.Done()
+		<-p.Done()
+		p.Close()
 		p.Println("portal closed")
 	}()
+
+	select {
+	case err = <-ready:
+	case <-time.After(setupTimeout):
+		// the session is dropped as soon as (if ever) it gets ready
+		cancel()
+		writeError(r, fasthttp.StatusGatewayTimeout, "session setup timeout")
+		return
+	}
+	if err != nil {
+		log.Println("can't start portal", name, err)
+		status := fasthttp.StatusInternalServerError
+		switch {
+		case errors.Is(err, anim.ErrNoServer):
+			status = fasthttp.StatusServiceUnavailable
+		case errors.Is(err, anim.ErrConnect) || errors.Is(err, ErrLivekit):
+			status = fasthttp.StatusBadGateway
+		}
+		writeError(r, status, err.Error())
+		return
+	}
+
+	writeJson(r, fasthttp.StatusOK, &animateReply{
+		Token:   t,
+		Room:    dummy,
+		Ws:      ap.PortalConf.Ws,
+		Session: dummy,
+	})
+}
+
+// GET /servers
+func (ap *AnimationPortal) ServersHandler(r *fasthttp.RequestCtx) {
+	if ap.pool == nil {
+		writeError(r, fasthttp.StatusNotFound, "no animation servers")
+		return
+	}
+	writeJson(r, fasthttp.StatusOK, ap.pool.Stats())
+}
+
+// Close() terminates all the sessions and waits till their rooms are disconnected
+func (ap *AnimationPortal) Close() {
+	ap.CancelFunc()
+	ap.wg.Wait()
 }
 
 func (ap *AnimationPortal) signToken(lifetime time.Duration, uid, name, room string) (token string, err error) {
@@ -2,11 +2,15 @@ package animportal
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"os"
 	"path"
 	"testing"
 	"time"
 
 	"github.com/dmisol/animportal/dummyclient"
+	"github.com/valyala/fasthttp"
 )
 
 func TestPortal(t *testing.T) {
@@ -33,3 +37,27 @@ func TestPortal(t *testing.T) {
 	<-ctx.Done()
 	u.Println("portal closed")
 }
+
+func TestHandlerNoName(t *testing.T) {
+	ap := &AnimationPortal{sessions: make(map[string]*user)}
+
+	r := &fasthttp.RequestCtx{}
+	r.Request.SetRequestURI("/animate?hall=ft")
+	ap.Handler(r)
+
+	if r.Response.StatusCode() != fasthttp.StatusBadRequest {
+		t.Fatal("expected 400, got", r.Response.StatusCode())
+	}
+	var e errorReply
+	if err := json.Unmarshal(r.Response.Body(), &e); err != nil || e.Error != "no name" {
+		t.Fatal("unexpected reply", string(r.Response.Body()), err)
+	}
+}
+
+func TestNewPortalTransport(t *testing.T) {
+	name := path.Join(t.TempDir(), "portal.yaml")
+	os.WriteFile(name, []byte("transport: in-band\n"), 0666)
+	if _, err := NewPortal(name); !errors.Is(err, ErrTransport) {
+		t.Fatal("ErrTransport expected, got", err)
+	}
+}
@@ -4,9 +4,12 @@ import (
 	"context"
 	"io"
 	"log"
+	"time"
 
 	lksdk "github.com/livekit/server-sdk-go"
 	webrtc "github.com/pion/webrtc/v3"
+	"github.com/pion/webrtc/v3/pkg/media"
+	"github.com/pion/webrtc/v3/pkg/media/ivfreader"
 )
 
 const (
@@ -53,6 +56,11 @@ func (r *Relay) AddTrack(remote *webrtc.TrackRemote) {
 }
 
 func (r *Relay) AddReadCloser(rc io.ReadCloser, mime string) {
+	if mime == webrtc.MimeTypeVP9 {
+		// not supported by reader tracks
+		r.addIvf(rc, mime)
+		return
+	}
 	track, err := lksdk.NewLocalReaderTrack(rc, mime)
 	if err != nil {
 		r.Println("local track", err)
@@ -66,6 +74,50 @@ func (r *Relay) AddReadCloser(rc io.ReadCloser, mime string) {
 	r.Println("relaying rc", mime)
 }
 
+// AddLocalTrack() publishes track, already carrying rtp
+func (r *Relay) AddLocalTrack(track webrtc.TrackLocal) {
+	if _, err := r.Room.LocalParticipant.PublishTrack(track, &lksdk.TrackPublicationOptions{}); err != nil {
+		r.Println("addLocal", err)
+		return
+	}
+	r.Println("relaying local", track.Kind(), track.ID())
+}
+
+// addIvf() publishes frames from ivf stream as samples
+func (r *Relay) addIvf(rc io.ReadCloser, mime string) {
+	track, err := lksdk.NewLocalSampleTrack(webrtc.RTPCodecCapability{MimeType: mime})
+	if err != nil {
+		r.Println("local track", err)
+		return
+	}
+	if _, err = r.Room.LocalParticipant.PublishTrack(track, &lksdk.TrackPublicationOptions{}); err != nil {
+		r.Println("addIvf", err)
+		return
+	}
+	r.Println("relaying ivf", mime)
+
+	go func() {
+		defer rc.Close()
+
+		ivf, hdr, err := ivfreader.NewWith(rc)
+		if err != nil {
+			r.Println("ivf header", err)
+			return
+		}
+		dt := time.Second * time.Duration(hdr.TimebaseNumerator) / time.Duration(hdr.TimebaseDenominator)
+		for {
+			frame, _, err := ivf.ParseNextFrame()
+			if err != nil {
+				r.Println("ivf frame", err)
+				return
+			}
+			if err = track.WriteSample(media.Sample{Data: frame, Duration: dt}, nil); err != nil {
+				r.Println("ivf sample", err)
+			}
+		}
+	}()
+}
+
 func (r *Relay) Close() {
 	r.Println("closing")
 	r.CancelFunc()
@@ -0,0 +1,220 @@
+package animportal
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/dmisol/animportal/anim"
+	"github.com/dmisol/animportal/tts"
+	"github.com/valyala/fasthttp"
+)
+
+const sessionsPath = "/sessions"
+
+type sessionInfo struct {
+	Id      string      `json:"id"`
+	Owner   string      `json:"owner"`
+	Hall    string      `json:"hall"`
+	Ftar    string      `json:"ftar"`
+	Started time.Time   `json:"started"`
+	Relays  []string    `json:"relays"`
+	Engine  *anim.Stats `json:"engine,omitempty"`
+}
+
+func (u *user) info() (si *sessionInfo) {
+	si = &sessionInfo{
+		Id:      u.room,
+		Owner:   u.Owner,
+		Hall:    u.hall,
+		Started: u.t0,
+		Relays:  make([]string, 0),
+	}
+
+	u.mu.Lock()
+	si.Ftar = u.ftar
+	for id := range u.Relays {
+		si.Relays = append(si.Relays, id)
+	}
+	u.mu.Unlock()
+	sort.Strings(si.Relays)
+
+	if u.Engine != nil {
+		s := u.Engine.Stats()
+		si.Engine = &s
+	}
+	return
+}
+
+func (ap *AnimationPortal) register(u *user) {
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+
+	ap.sessions[u.room] = u
+}
+
+func (ap *AnimationPortal) unregister(u *user) {
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+
+	if ap.sessions[u.room] == u {
+		delete(ap.sessions, u.room)
+	}
+}
+
+func (ap *AnimationPortal) session(id string) (u *user, ok bool) {
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+
+	u, ok = ap.sessions[id]
+	return
+}
+
+// GET /sessions
+// GET /sessions/{id}
+// DELETE /sessions/{id}
+// POST /sessions/{id}/say
+// POST /sessions/{id}/play
+// POST, GET (websocket) /sessions/{id}/control
+func (ap *AnimationPortal) SessionsHandler(r *fasthttp.RequestCtx) {
+	id := strings.Trim(strings.TrimPrefix(string(r.Path()), sessionsPath), "/")
+	id, action, _ := strings.Cut(id, "/")
+
+	if len(id) == 0 {
+		if !r.IsGet() {
+			writeError(r, fasthttp.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		ap.mu.Lock()
+		list := make([]*user, 0, len(ap.sessions))
+		for _, u := range ap.sessions {
+			list = append(list, u)
+		}
+		ap.mu.Unlock()
+
+		infos := make([]*sessionInfo, 0, len(list))
+		for _, u := range list {
+			infos = append(infos, u.info())
+		}
+		sort.Slice(infos, func(i, j int) bool { return infos[i].Started.Before(infos[j].Started) })
+		writeJson(r, fasthttp.StatusOK, infos)
+		return
+	}
+
+	u, ok := ap.session(id)
+	if !ok {
+		writeError(r, fasthttp.StatusNotFound, "no such session")
+		return
+	}
+
+	switch {
+	case action == "say":
+		if !r.IsPost() {
+			writeError(r, fasthttp.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		u.say(r)
+	case action == "play":
+		if !r.IsPost() {
+			writeError(r, fasthttp.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		u.play(r)
+	case action == "control":
+		u.control(r)
+	case action != "":
+		writeError(r, fasthttp.StatusNotFound, "not found")
+	case r.IsGet():
+		writeJson(r, fasthttp.StatusOK, u.info())
+	case r.IsDelete():
+		u.Println("terminated by request")
+		ap.unregister(u)
+		u.Close()
+		r.SetStatusCode(fasthttp.StatusNoContent)
+	default:
+		writeError(r, fasthttp.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+type sayRequest struct {
+	Text string `json:"text"`
+}
+
+type sayReply struct {
+	Duration int64 `json:"duration_ms"`
+}
+
+// say() accepts {"text": "..."} or plain text
+func (u *user) say(r *fasthttp.RequestCtx) {
+	req := &sayRequest{}
+	if strings.HasPrefix(string(r.Request.Header.ContentType()), "application/json") {
+		if err := json.Unmarshal(r.PostBody(), req); err != nil {
+			writeError(r, fasthttp.StatusBadRequest, "bad json")
+			return
+		}
+	} else {
+		req.Text = string(r.PostBody())
+	}
+	if strings.TrimSpace(req.Text) == "" {
+		writeError(r, fasthttp.StatusBadRequest, "no text")
+		return
+	}
+	if u.Engine == nil {
+		writeError(r, fasthttp.StatusServiceUnavailable, "no engine")
+		return
+	}
+
+	d, err := u.Engine.Say(req.Text)
+	switch {
+	case err == nil:
+		writeJson(r, fasthttp.StatusAccepted, &sayReply{Duration: d.Milliseconds()})
+	case errors.Is(err, tts.ErrNoTts):
+		writeError(r, fasthttp.StatusNotImplemented, err.Error())
+	case errors.Is(err, anim.ErrBusy):
+		writeError(r, fasthttp.StatusServiceUnavailable, err.Error())
+	default:
+		u.Println("say", err)
+		writeError(r, fasthttp.StatusBadGateway, err.Error())
+	}
+}
+
+// play() accepts defs.Anim entries, json array or lines
+func (u *user) play(r *fasthttp.RequestCtx) {
+	script, err := anim.ParseScript(bytes.NewReader(r.PostBody()))
+	if err != nil {
+		writeError(r, fasthttp.StatusBadRequest, err.Error())
+		return
+	}
+	if u.Engine == nil {
+		writeError(r, fasthttp.StatusServiceUnavailable, "no engine")
+		return
+	}
+
+	d, err := u.Engine.Play(script)
+	switch {
+	case err == nil:
+		writeJson(r, fasthttp.StatusAccepted, &sayReply{Duration: d.Milliseconds()})
+	case errors.Is(err, anim.ErrNoScripts):
+		writeError(r, fasthttp.StatusNotImplemented, err.Error())
+	case errors.Is(err, anim.ErrScript):
+		writeError(r, fasthttp.StatusBadRequest, err.Error())
+	case errors.Is(err, anim.ErrPlaying):
+		writeError(r, fasthttp.StatusConflict, err.Error())
+	default:
+		writeError(r, fasthttp.StatusInternalServerError, err.Error())
+	}
+}
+
+func writeJson(r *fasthttp.RequestCtx, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		r.Error("can't marshal json", fasthttp.StatusInternalServerError)
+		return
+	}
+	r.SetContentType("application/json")
+	r.SetStatusCode(status)
+	r.SetBody(b)
+}
@@ -0,0 +1,96 @@
+package animportal
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/valyala/fasthttp"
+)
+
+func testRequest(ap *AnimationPortal, method string, uri string) *fasthttp.RequestCtx {
+	r := &fasthttp.RequestCtx{}
+	r.Request.Header.SetMethod(method)
+	r.Request.SetRequestURI(uri)
+	ap.SessionsHandler(r)
+	return r
+}
+
+func TestSessions(t *testing.T) {
+	ap := &AnimationPortal{sessions: make(map[string]*user)}
+
+	dir := path.Join(t.TempDir(), "1")
+	os.MkdirAll(dir, 0777)
+
+	u := &user{room: "abc", Owner: "bob", hall: "ft", dirs: []string{dir}, t0: time.Now()}
+	u.Context, u.CancelFunc = context.WithCancel(context.Background())
+	ap.register(u)
+
+	r := testRequest(ap, fasthttp.MethodGet, "/sessions")
+	var list []*sessionInfo
+	if err := json.Unmarshal(r.Response.Body(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Id != "abc" || list[0].Owner != "bob" {
+		t.Fatal("unexpected list", string(r.Response.Body()))
+	}
+
+	if r = testRequest(ap, fasthttp.MethodGet, "/sessions/xyz"); r.Response.StatusCode() != fasthttp.StatusNotFound {
+		t.Fatal("expected 404, got", r.Response.StatusCode())
+	}
+
+	if r = testRequest(ap, fasthttp.MethodDelete, "/sessions/abc"); r.Response.StatusCode() != fasthttp.StatusNoContent {
+		t.Fatal("expected 204, got", r.Response.StatusCode())
+	}
+	if u.Err() == nil {
+		t.Fatal("session not cancelled")
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Fatal("dir not removed", err)
+	}
+	if _, ok := ap.session("abc"); ok {
+		t.Fatal("session not unregistered")
+	}
+}
+
+func TestSayPlay(t *testing.T) {
+	ap := &AnimationPortal{sessions: make(map[string]*user)}
+	u := &user{room: "abc", Owner: "bob", t0: time.Now()}
+	ap.register(u)
+
+	say := func(method string, uri string, ctype string, body string) int {
+		r := &fasthttp.RequestCtx{}
+		r.Request.Header.SetMethod(method)
+		r.Request.Header.SetContentType(ctype)
+		r.Request.SetRequestURI(uri)
+		r.Request.SetBodyString(body)
+		ap.SessionsHandler(r)
+		// errors are json, whatever the path
+		var e errorReply
+		if err := json.Unmarshal(r.Response.Body(), &e); err != nil || e.Error == "" {
+			t.Fatal(method, uri, "unexpected reply", string(r.Response.Body()))
+		}
+		return r.Response.StatusCode()
+	}
+	for _, c := range []struct {
+		method, uri, ctype, body string
+		status                   int
+	}{
+		{fasthttp.MethodGet, "/sessions/abc/say", "text/plain", "hi", fasthttp.StatusMethodNotAllowed},
+		{fasthttp.MethodPost, "/sessions/abc/shout", "text/plain", "hi", fasthttp.StatusNotFound},
+		{fasthttp.MethodPost, "/sessions/xyz/say", "text/plain", "hi", fasthttp.StatusNotFound},
+		{fasthttp.MethodPost, "/sessions/abc/say", "text/plain", " ", fasthttp.StatusBadRequest},
+		{fasthttp.MethodPost, "/sessions/abc/say", "application/json", `{"text": 1}`, fasthttp.StatusBadRequest},
+		{fasthttp.MethodPost, "/sessions/abc/say", "application/json", `{"text": "hi"}`, fasthttp.StatusServiceUnavailable},
+		{fasthttp.MethodGet, "/sessions/abc/play", "application/json", `[]`, fasthttp.StatusMethodNotAllowed},
+		{fasthttp.MethodPost, "/sessions/abc/play", "application/json", `[{"ts": "x"}]`, fasthttp.StatusBadRequest},
+		{fasthttp.MethodPost, "/sessions/abc/play", "application/json", `{"ts": 0, "pattern": [1]}`, fasthttp.StatusServiceUnavailable},
+	} {
+		if status := say(c.method, c.uri, c.ctype, c.body); status != c.status {
+			t.Fatal(c.method, c.uri, c.body, "expected", c.status, "got", status)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+// Package tts turns text into speech for the flexatar to say.
+//
+// Synth is pluggable; Command runs an espeak-style program that prints wav to stdout,
+// File is a stand-in giving the same wav for any text.
+package tts
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+const (
+	filePrefix = "file:"
+
+	synthTimeout = 10 * time.Second
+)
+
+var (
+	ErrNoTts = errors.New("tts is not configured")
+	ErrWav   = errors.New("unsupported wav")
+)
+
+// Speech is 16 bit mono pcm, little endian
+type Speech struct {
+	Pcm  []byte
+	Rate int
+}
+
+func (s *Speech) Duration() time.Duration {
+	return time.Duration(len(s.Pcm)/2) * time.Second / time.Duration(s.Rate)
+}
+
+type Synth interface {
+	Synthesize(ctx context.Context, text string) (*Speech, error)
+}
+
+// New() makes Synth from PortalConf.Tts:
+// "file:/path/to.wav" is File, anything else is Command line, e.g. "espeak-ng --stdout -v en"
+func New(conf string) (s Synth, err error) {
+	switch {
+	case len(strings.Fields(conf)) == 0:
+		err = ErrNoTts
+	case strings.HasPrefix(conf, filePrefix):
+		s = &File{Path: strings.TrimPrefix(conf, filePrefix)}
+	default:
+		s = &Command{Args: strings.Fields(conf)}
+	}
+	return
+}
+
+// Command runs Args with the text appended, reads wav from stdout
+type Command struct {
+	Args []string
+}
+
+func (c *Command) Synthesize(ctx context.Context, text string) (s *Speech, err error) {
+	if len(c.Args) == 0 {
+		err = ErrNoTts
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, synthTimeout)
+	defer cancel()
+
+	args := append(append([]string{}, c.Args[1:]...), text)
+	cmd := exec.CommandContext(ctx, c.Args[0], args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+
+	var b []byte
+	if b, err = cmd.Output(); err != nil {
+		err = fmt.Errorf("%s: %v %s", c.Args[0], err, strings.TrimSpace(stderr.String()))
+		return
+	}
+	return ParseWav(b)
+}
+
+// File says the same for any text
+type File struct {
+	Path string
+}
+
+func (f *File) Synthesize(ctx context.Context, text string) (s *Speech, err error) {
+	var b []byte
+	if b, err = os.ReadFile(f.Path); err != nil {
+		return
+	}
+	return ParseWav(b)
+}
+
+// ParseWav() accepts 16 bit pcm, stereo is mixed down
+// sizes may be bogus, as streaming programs write them
+func ParseWav(b []byte) (s *Speech, err error) {
+	if len(b) < 12 || string(b[0:4]) != "RIFF" || string(b[8:12]) != "WAVE" {
+		err = ErrWav
+		return
+	}
+	var channels, bits int
+	for b = b[12:]; len(b) >= 8; {
+		id := string(b[0:4])
+		size := int(binary.LittleEndian.Uint32(b[4:8]))
+		b = b[8:]
+		if size > len(b) || size < 0 {
+			size = len(b)
+		}
+		switch id {
+		case "fmt ":
+			if size < 16 || binary.LittleEndian.Uint16(b[0:2]) != 1 {
+				err = fmt.Errorf("%w: not pcm", ErrWav)
+				return
+			}
+			channels = int(binary.LittleEndian.Uint16(b[2:4]))
+			s = &Speech{Rate: int(binary.LittleEndian.Uint32(b[4:8]))}
+			bits = int(binary.LittleEndian.Uint16(b[14:16]))
+		case "data":
+			if s == nil || bits != 16 || channels < 1 || channels > 2 {
+				err = fmt.Errorf("%w: %d channels, %d bits", ErrWav, channels, bits)
+				return
+			}
+			s.Pcm = mono(b[:size&^1], channels)
+			return
+		}
+		b = b[size+size&1:]
+	}
+	err = fmt.Errorf("%w: no data", ErrWav)
+	return
+}
+
+func mono(pcm []byte, channels int) []byte {
+	if channels == 1 {
+		return pcm
+	}
+	out := make([]byte, len(pcm)/4*2)
+	for i := 0; i+3 < len(pcm); i += 4 {
+		l := int(int16(binary.LittleEndian.Uint16(pcm[i:])))
+		r := int(int16(binary.LittleEndian.Uint16(pcm[i+2:])))
+		binary.LittleEndian.PutUint16(out[i/2:], uint16(int16((l+r)/2)))
+	}
+	return out
+}
+
+// Wav() makes mono 16 bit wav
+func Wav(s *Speech) (b []byte) {
+	b = make([]byte, 44+len(s.Pcm))
+	copy(b[0:], "RIFF")
+	binary.LittleEndian.PutUint32(b[4:], uint32(36+len(s.Pcm)))
+	copy(b[8:], "WAVEfmt ")
+	binary.LittleEndian.PutUint32(b[16:], 16)
+	binary.LittleEndian.PutUint16(b[20:], 1) // pcm
+	binary.LittleEndian.PutUint16(b[22:], 1) // mono
+	binary.LittleEndian.PutUint32(b[24:], uint32(s.Rate))
+	binary.LittleEndian.PutUint32(b[28:], uint32(s.Rate*2))
+	binary.LittleEndian.PutUint16(b[32:], 2)
+	binary.LittleEndian.PutUint16(b[34:], 16)
+	copy(b[36:], "data")
+	binary.LittleEndian.PutUint32(b[40:], uint32(len(s.Pcm)))
+	copy(b[44:], s.Pcm)
+	return
+}
@@ -0,0 +1,75 @@
+package tts
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestWav(t *testing.T) {
+	s := &Speech{Pcm: make([]byte, 22050*2), Rate: 22050}
+	p, err := ParseWav(Wav(s))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Rate != 22050 || len(p.Pcm) != len(s.Pcm) || p.Duration() != time.Second {
+		t.Fatal("unexpected", p.Rate, len(p.Pcm), p.Duration())
+	}
+
+	// streamed, bogus size
+	b := Wav(s)
+	binary.LittleEndian.PutUint32(b[40:], 0x7fffffff)
+	if p, err = ParseWav(b); err != nil || len(p.Pcm) != len(s.Pcm) {
+		t.Fatal("streamed", err)
+	}
+
+	// stereo is mixed down
+	b = Wav(&Speech{Pcm: []byte{0x10, 0, 0x30, 0}, Rate: 8000})
+	binary.LittleEndian.PutUint16(b[22:], 2)
+	if p, err = ParseWav(b); err != nil || len(p.Pcm) != 2 || p.Pcm[0] != 0x20 {
+		t.Fatal("stereo", err, p.Pcm)
+	}
+
+	if _, err = ParseWav([]byte("RIFF....WAVE")); !errors.Is(err, ErrWav) {
+		t.Fatal("ErrWav expected, got", err)
+	}
+}
+
+func TestSynth(t *testing.T) {
+	name := path.Join(t.TempDir(), "hello.wav")
+	if err := os.WriteFile(name, Wav(&Speech{Pcm: make([]byte, 3200), Rate: 16000}), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// espeak-style: wav to stdout, the text is the last argument
+	script := path.Join(t.TempDir(), "say.sh")
+	if err := os.WriteFile(script, []byte("test -n \"$1\" && cat "+name), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, conf := range []string{"", " \t"} {
+		if _, err := New(conf); err != ErrNoTts {
+			t.Fatal("ErrNoTts expected, got", err)
+		}
+	}
+	if _, err := (&Command{}).Synthesize(context.Background(), "hello"); err != ErrNoTts {
+		t.Fatal("ErrNoTts expected, got", err)
+	}
+	for _, conf := range []string{"file:" + name, "sh " + script} {
+		s, err := New(conf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sp, err := s.Synthesize(context.Background(), "hello")
+		if err != nil {
+			t.Fatal(conf, err)
+		}
+		if sp.Duration() != 100*time.Millisecond {
+			t.Fatal(conf, "unexpected duration", sp.Duration())
+		}
+	}
+}
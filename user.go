@@ -2,9 +2,12 @@ package animportal
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"os"
 	"path"
 	"sync"
+	"time"
 
 	"github.com/dmisol/animportal/anim"
 	"github.com/dmisol/animportal/defs"
@@ -18,10 +21,22 @@ func (ap *AnimationPortal) newUser(ctx context.Context, hall string, dummy strin
 		Relays: make(map[string]*relay.Relay),
 		Owner:  name,
 		room:   dummy,
+		hall:   hall,
+		ftar:   conf.InitialJson.Ftar,
+		dirs:   sessionDirs(conf, dummy),
+		t0:     time.Now(),
 		conf:   ap.PortalConf,
 	}
 	u.Context, u.CancelFunc = context.WithCancel(ctx)
 
+	// roll back whatever is already set up
+	defer func() {
+		if err != nil {
+			u.Close()
+			u = nil
+		}
+	}()
+
 	// subscribe to hall, set cb to colect participants
 	if u.Hall, err = lksdk.ConnectToRoom(ap.PortalConf.Ws, lksdk.ConnectInfo{
 		APIKey:              ap.PortalConf.Key,
@@ -33,10 +48,11 @@ func (ap *AnimationPortal) newUser(ctx context.Context, hall string, dummy strin
 			OnTrackSubscribed: u.hallCb,
 		},
 	}, func(cp *lksdk.ConnectParams) { cp.AutoSubscribe = false }); err != nil {
-		panic(err)
+		err = fmt.Errorf("%w, hall %s: %v", ErrLivekit, hall, err)
+		return
 	}
 
-	if u.Engine, err = anim.NewEngine(u.Context, ap.PortalConf.AnimAddr, path.Join(ap.PortalConf.Ram, dummy), u.Hall, conf); err != nil {
+	if u.Engine, err = anim.NewEngine(u.Context, ap.pool, path.Join(ap.PortalConf.Ram, dummy), u.Hall, conf); err != nil {
 		return
 	}
 
@@ -51,9 +67,11 @@ func (ap *AnimationPortal) newUser(ctx context.Context, hall string, dummy strin
 		ParticipantCallback: lksdk.ParticipantCallback{
 			OnTrackSubscribed:  u.dummyCb,
 			OnTrackUnpublished: u.stop,
+			OnDataReceived:     u.onData,
 		},
 	}, func(cp *lksdk.ConnectParams) { cp.AutoSubscribe = false }); err != nil {
-		panic(err)
+		err = fmt.Errorf("%w, dummy %s: %v", ErrLivekit, dummy, err)
+		return
 	}
 
 	return
@@ -67,15 +85,40 @@ func (u *user) stop(publication *lksdk.RemoteTrackPublication, rp *lksdk.RemoteP
 }
 
 func (u *user) Close() {
+	u.once.Do(func() {
+		if u.Dummy != nil {
+			u.Dummy.Disconnect()
+		}
+		if u.Hall != nil {
+			u.Hall.Disconnect()
+		}
+		if u.Engine != nil {
+			u.Engine.Close()
+		}
 
-	if u.Dummy != nil {
-		u.Dummy.Disconnect()
+		u.CancelFunc()
+		u.removeDirs()
+	})
+}
+
+// sessionDirs() lists ramdisk folders to be created by the session
+func sessionDirs(conf defs.PortalConf, dummy string) (dirs []string) {
+	if len(conf.InitialJson.Dir) > 0 {
+		dirs = append(dirs, path.Clean(conf.InitialJson.Dir))
 	}
-	if u.Hall != nil {
-		u.Hall.Disconnect()
+	if len(conf.Ram) > 0 && conf.Transport != defs.TransportInband {
+		dirs = append(dirs, path.Join(conf.Ram, dummy))
 	}
+	return
+}
 
-	u.CancelFunc()
+// removeDirs() cleans ramdisk folders used by the session
+func (u *user) removeDirs() {
+	for _, d := range u.dirs {
+		if err := os.RemoveAll(d); err != nil {
+			u.Println("rm", d, err)
+		}
+	}
 }
 
 func (u *user) Println(i ...interface{}) {
@@ -87,9 +130,14 @@ type user struct {
 
 	context.Context
 	context.CancelFunc
-	mu sync.Mutex
+	mu   sync.Mutex
+	once sync.Once
 
 	room string
+	hall string
+	ftar string
+	dirs []string
+	t0   time.Time
 
 	Dummy, Hall *lksdk.Room             // connections for the given user, who is to be replaced with flexatar
 	Relays      map[string]*relay.Relay //*lksdk.Room // connections to Dummy to publish all Halls' publishers
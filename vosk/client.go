@@ -0,0 +1,179 @@
+// Package vosk streams pcm to vosk-server compatible websocket endpoint
+// and turns recognized words (and phones, if the model gives them) into visemes.
+//
+// https://github.com/alphacep/vosk-server
+//
+//	-> {"config": {"sample_rate": 16000, "words": 1}}
+//	-> pcm, binary
+//	<- {"partial": "hel"}
+//	<- {"result": [{"word": "hello", "start": 0.5, "end": 0.9, "conf": 1}], "text": "hello"}
+//	-> {"eof": 1}
+//	<- final result, then the server closes
+package vosk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/dmisol/animportal/defs"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	TypeWord  = "word"
+	TypePhone = "phone"
+
+	eofTimeout   = 2 * time.Second // to get the final result
+	dialTimeout  = 2 * time.Second // handshake and config, the caller waits for it
+	writeTimeout = time.Second     // a stalled server fails the write
+)
+
+var (
+	ErrClosed = errors.New("vosk client closed")
+)
+
+type config struct {
+	Config struct {
+		SampleRate int `json:"sample_rate"`
+		Words      int `json:"words"`
+	} `json:"config"`
+}
+
+type item struct {
+	Word  string  `json:"word,omitempty"`
+	Phone string  `json:"phone,omitempty"`
+	Start float64 `json:"start"` // s
+	End   float64 `json:"end"`   // s
+	Conf  float64 `json:"conf"`
+}
+
+type result struct {
+	Result  []item `json:"result,omitempty"`
+	Text    string `json:"text,omitempty"`
+	Partial string `json:"partial,omitempty"`
+}
+
+// Client is safe for one writer; results are reported from its own goroutine
+type Client struct {
+	conn *websocket.Conn
+	mu   sync.Mutex
+	done chan struct{}
+
+	onResult func(phones []*defs.Viseme)
+	closed   bool
+}
+
+// Dial() connects and configures the recognizer; onResult gets final results,
+// with Time in ms since the first pcm written; a silent server fails it in dialTimeout
+func Dial(ctx context.Context, url string, rate int, onResult func(phones []*defs.Viseme)) (c *Client, err error) {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+
+	c = &Client{done: make(chan struct{}), onResult: onResult}
+	if c.conn, _, err = websocket.DefaultDialer.DialContext(ctx, url, nil); err != nil {
+		c = nil
+		return
+	}
+	deadline, _ := ctx.Deadline()
+	c.conn.SetWriteDeadline(deadline)
+	cfg := &config{}
+	cfg.Config.SampleRate = rate
+	cfg.Config.Words = 1
+	if err = c.conn.WriteJSON(cfg); err != nil {
+		c.conn.Close()
+		c = nil
+		return
+	}
+	c.conn.SetWriteDeadline(time.Time{})
+	go c.run()
+	return
+}
+
+// Write() sends 16 bit mono pcm
+func (c *Client) Write(pcm []byte) (i int, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.closed {
+		err = ErrClosed
+		return
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	if err = c.conn.WriteMessage(websocket.BinaryMessage, pcm); err == nil {
+		i = len(pcm)
+	}
+	return
+}
+
+// Close() asks for the final result and waits for it a bit
+func (c *Client) Close() (err error) {
+	c.mu.Lock()
+	if c.closed {
+		c.mu.Unlock()
+		return
+	}
+	c.closed = true
+	c.conn.SetWriteDeadline(time.Now().Add(writeTimeout))
+	err = c.conn.WriteMessage(websocket.TextMessage, []byte(`{"eof" : 1}`))
+	c.mu.Unlock()
+
+	if err == nil {
+		select {
+		case <-c.done:
+		case <-time.After(eofTimeout):
+			c.Println("no final result")
+		}
+	}
+	c.conn.Close()
+	<-c.done
+	return
+}
+
+func (c *Client) run() {
+	defer close(c.done)
+
+	for {
+		_, b, err := c.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		r := &result{}
+		if err = json.Unmarshal(b, r); err != nil {
+			c.Println("result", err)
+			continue
+		}
+		if len(r.Result) == 0 {
+			// partial or nothing recognized
+			continue
+		}
+		if c.onResult != nil {
+			c.onResult(toVisemes(r.Result))
+		}
+	}
+}
+
+func toVisemes(items []item) (phones []*defs.Viseme) {
+	for _, it := range items {
+		v := &defs.Viseme{
+			Time:     int(math.Round(it.Start * 1000)),
+			Type:     TypeWord,
+			Value:    it.Word,
+			Duration: int(math.Round((it.End - it.Start) * 1000)),
+		}
+		if it.Phone != "" {
+			v.Type = TypePhone
+			v.Value = it.Phone
+		}
+		phones = append(phones, v)
+	}
+	return
+}
+
+func (c *Client) Println(i ...interface{}) {
+	log.Println("vosk", i)
+}
@@ -0,0 +1,133 @@
+package vosk
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dmisol/animportal/defs"
+	"github.com/gorilla/websocket"
+)
+
+// fakeVosk recognizes a word per second of 16 kHz pcm, and phones on eof
+func fakeVosk(t *testing.T, rate chan int) *httptest.Server {
+	up := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c, err := up.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer c.Close()
+
+		bytes, words := 0, 0
+		for {
+			typ, b, err := c.ReadMessage()
+			if err != nil {
+				return
+			}
+			if typ == websocket.TextMessage {
+				if strings.Contains(string(b), "eof") {
+					c.WriteMessage(websocket.TextMessage, []byte(`{"result": [{"phone": "a", "start": 2.0, "end": 2.1, "conf": 1}], "text": ""}`))
+					return
+				}
+				cfg := &config{}
+				json.Unmarshal(b, cfg)
+				rate <- cfg.Config.SampleRate
+				continue
+			}
+			bytes += len(b)
+			if bytes/32000 > words {
+				words++
+				c.WriteMessage(websocket.TextMessage, []byte(`{"partial": "hel"}`))
+				c.WriteJSON(&result{Result: []item{{Word: "hello", Start: float64(words) - 0.5, End: float64(words) - 0.1, Conf: 1}}, Text: "hello"})
+			} else {
+				c.WriteMessage(websocket.TextMessage, []byte(`{"partial": ""}`))
+			}
+		}
+	}))
+}
+
+func TestClient(t *testing.T) {
+	rate := make(chan int, 1)
+	srv := fakeVosk(t, rate)
+	defer srv.Close()
+
+	var mu sync.Mutex
+	var got []*defs.Viseme
+	c, err := Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), 16000, func(phones []*defs.Viseme) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, phones...)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r := <-rate; r != 16000 {
+		t.Fatal("unexpected rate", r)
+	}
+
+	pcm := make([]byte, 1600)
+	for i := 0; i < 20; i++ {
+		if _, err = c.Write(pcm); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Close()
+	if _, err = c.Write(pcm); err != ErrClosed {
+		t.Fatal("ErrClosed expected, got", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 {
+		t.Fatal("unexpected results", len(got))
+	}
+	if w := got[0]; w.Type != TypeWord || w.Value != "hello" || w.Time != 500 || w.Duration != 400 {
+		t.Fatalf("unexpected word %+v", w)
+	}
+	if p := got[1]; p.Type != TypePhone || p.Value != "a" || p.Time != 2000 || p.Duration != 100 {
+		t.Fatalf("unexpected phone %+v", p)
+	}
+}
+
+func TestDialFails(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	if _, err := Dial(context.Background(), "ws"+strings.TrimPrefix(srv.URL, "http"), 16000, nil); err == nil {
+		t.Fatal("error expected")
+	}
+}
+
+func TestDialTimeout(t *testing.T) {
+	// accepts, never answers the handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+		}
+	}()
+
+	t0 := time.Now()
+	if _, err = Dial(context.Background(), "ws://"+l.Addr().String(), 16000, nil); err == nil {
+		t.Fatal("dialed a silent server")
+	}
+	if d := time.Since(t0); d > 2*dialTimeout {
+		t.Fatal("Dial() took", d)
+	}
+}
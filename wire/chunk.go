@@ -0,0 +1,59 @@
+package wire
+
+import (
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+const chunkHdr = 4
+
+var (
+	ErrChunk = errors.New("malformed chunk")
+)
+
+// EncodeChunk() makes Audio or Pcm payload, since StampVersion:
+//
+//	media  4 bytes, big endian, ms since the stream start
+//	data   file name or pcm samples
+func EncodeChunk(media time.Duration, data []byte) (b []byte) {
+	b = make([]byte, chunkHdr+len(data))
+	binary.BigEndian.PutUint32(b, uint32(media.Milliseconds()))
+	copy(b[chunkHdr:], data)
+	return
+}
+
+// DecodeChunk() parses Audio or Pcm payload, since StampVersion
+func DecodeChunk(b []byte) (media time.Duration, data []byte, err error) {
+	if len(b) < chunkHdr {
+		err = ErrChunk
+		return
+	}
+	media = time.Duration(binary.BigEndian.Uint32(b)) * time.Millisecond
+	data = b[chunkHdr:]
+	return
+}
+
+// EncodeIdle() makes Idle payload, the server may play idle pattern meanwhile:
+//
+//	media    4 bytes, big endian, ms since the stream start
+//	duration 4 bytes, big endian, ms
+func EncodeIdle(media time.Duration, d time.Duration) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(d.Milliseconds()))
+	return EncodeChunk(media, b)
+}
+
+// DecodeIdle() parses Idle payload
+func DecodeIdle(b []byte) (media time.Duration, d time.Duration, err error) {
+	var data []byte
+	if media, data, err = DecodeChunk(b); err != nil {
+		return
+	}
+	if len(data) != 4 {
+		err = ErrChunk
+		return
+	}
+	d = time.Duration(binary.BigEndian.Uint32(data)) * time.Millisecond
+	return
+}
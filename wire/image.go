@@ -0,0 +1,85 @@
+package wire
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/png"
+)
+
+type ImageFormat byte
+
+const (
+	PNG  ImageFormat = iota + 1 // png file content
+	RGB                         // packed 8 bit r,g,b
+	I420                        // planar y, u, v; chroma subsampled 2x2
+)
+
+const imageHdr = 5
+
+var (
+	ErrImage = errors.New("malformed image")
+)
+
+// EncodeImage() makes Image payload:
+//
+//	format 1 byte
+//	width  2 bytes, big endian
+//	height 2 bytes, big endian
+//	data
+func EncodeImage(f ImageFormat, w int, h int, data []byte) (b []byte) {
+	b = make([]byte, imageHdr+len(data))
+	b[0] = byte(f)
+	binary.BigEndian.PutUint16(b[1:3], uint16(w))
+	binary.BigEndian.PutUint16(b[3:5], uint16(h))
+	copy(b[imageHdr:], data)
+	return
+}
+
+// DecodeImage() parses Image payload
+func DecodeImage(b []byte) (img image.Image, err error) {
+	if len(b) < imageHdr {
+		err = ErrImage
+		return
+	}
+	w := int(binary.BigEndian.Uint16(b[1:3]))
+	h := int(binary.BigEndian.Uint16(b[3:5]))
+	data := b[imageHdr:]
+
+	switch ImageFormat(b[0]) {
+	case PNG:
+		img, err = png.Decode(bytes.NewReader(data))
+	case RGB:
+		if len(data) != w*h*3 {
+			err = ErrImage
+			return
+		}
+		rgba := image.NewRGBA(image.Rect(0, 0, w, h))
+		for i, j := 0, 0; i < len(data); i, j = i+3, j+4 {
+			rgba.Pix[j] = data[i]
+			rgba.Pix[j+1] = data[i+1]
+			rgba.Pix[j+2] = data[i+2]
+			rgba.Pix[j+3] = 0xff
+		}
+		img = rgba
+	case I420:
+		cw, ch := (w+1)/2, (h+1)/2
+		if len(data) != w*h+2*cw*ch {
+			err = ErrImage
+			return
+		}
+		img = &image.YCbCr{
+			Y:              data[:w*h],
+			Cb:             data[w*h : w*h+cw*ch],
+			Cr:             data[w*h+cw*ch:],
+			YStride:        w,
+			CStride:        cw,
+			SubsampleRatio: image.YCbCrSubsampleRatio420,
+			Rect:           image.Rect(0, 0, w, h),
+		}
+	default:
+		err = ErrImage
+	}
+	return
+}
@@ -0,0 +1,216 @@
+// Package wire implements framed messages between the portal and the animation server.
+//
+// every message is
+//
+//	type    1 byte
+//	length  4 bytes, big endian
+//	payload <length> bytes
+//
+// the client starts with Hello, the server replies with Hello, both carrying
+// magic and protocol version; the lower one is used
+package wire
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	Version    = 6 // the latest protocol version supported
+	MinVersion = 1 // the oldest protocol version supported
+
+	InbandVersion  = 2 // Pcm and Image are available since
+	StampVersion   = 3 // Audio and Pcm carry media timestamp since, see EncodeChunk()
+	IdleVersion    = 4 // Idle is available since
+	AnimVersion    = 5 // Anim is available since
+	ControlVersion = 6 // Control is available since
+
+	MaxPayload = 16 << 20
+
+	HelloTimeout = 5 * time.Second
+)
+
+type Type byte
+
+const (
+	Hello   Type = iota + 1 // magic + version, uint16
+	Init                    // defs.InitialJson
+	Audio                   // pcm file name, stamped since StampVersion
+	Frame                   // image file name
+	Error                   // text
+	Bye                     // no payload
+	Pcm                     // pcm samples, in-band, stamped since StampVersion
+	Image                   // see EncodeImage(), in-band
+	Idle                    // silence instead of Audio or Pcm, see EncodeIdle()
+	Anim                    // defs.Anim, phones with or instead of Audio or Pcm
+	Control                 // defs.Control, changes the running animation
+)
+
+func (t Type) String() string {
+	switch t {
+	case Hello:
+		return "hello"
+	case Init:
+		return "init"
+	case Audio:
+		return "audio"
+	case Frame:
+		return "frame"
+	case Error:
+		return "error"
+	case Bye:
+		return "bye"
+	case Pcm:
+		return "pcm"
+	case Image:
+		return "image"
+	case Idle:
+		return "idle"
+	case Anim:
+		return "anim"
+	case Control:
+		return "control"
+	}
+	return fmt.Sprintf("type(%d)", byte(t))
+}
+
+var (
+	ErrTooLarge = errors.New("payload too large")
+	ErrVersion  = errors.New("unsupported protocol version")
+
+	magic = []byte("ANIM")
+)
+
+type Msg struct {
+	Type    Type
+	Payload []byte
+}
+
+// Write() sends a single message
+func Write(w io.Writer, t Type, payload []byte) (err error) {
+	if len(payload) > MaxPayload {
+		return ErrTooLarge
+	}
+	b := make([]byte, 5+len(payload))
+	b[0] = byte(t)
+	binary.BigEndian.PutUint32(b[1:5], uint32(len(payload)))
+	copy(b[5:], payload)
+
+	_, err = w.Write(b)
+	return
+}
+
+// Read() fetches a single message, regardless of the way it was split into tcp segments
+func Read(r io.Reader) (m *Msg, err error) {
+	var hdr [5]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return
+	}
+	l := binary.BigEndian.Uint32(hdr[1:])
+	if l > MaxPayload {
+		err = ErrTooLarge
+		return
+	}
+	m = &Msg{Type: Type(hdr[0]), Payload: make([]byte, l)}
+	if _, err = io.ReadFull(r, m.Payload); err != nil {
+		m = nil
+	}
+	return
+}
+
+func NewConn(c net.Conn) *Conn {
+	return &Conn{Conn: c, rd: bufio.NewReader(c)}
+}
+
+// Conn is safe for one reader and many writers
+type Conn struct {
+	net.Conn
+	rd *bufio.Reader
+	mu sync.Mutex
+
+	Version uint16 // negotiated
+}
+
+func (c *Conn) Send(t Type, payload []byte) (err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return Write(c.Conn, t, payload)
+}
+
+func (c *Conn) SendJson(t Type, v interface{}) (err error) {
+	var b []byte
+	if b, err = json.Marshal(v); err != nil {
+		return
+	}
+	return c.Send(t, b)
+}
+
+func (c *Conn) Recv() (m *Msg, err error) {
+	return Read(c.rd)
+}
+
+// Hello() is called by the client to negotiate the version
+func (c *Conn) Hello() (err error) {
+	if err = c.Send(Hello, hello(Version)); err != nil {
+		return
+	}
+	var v uint16
+	if v, err = c.recvHello(); err != nil {
+		return
+	}
+	if v > Version {
+		v = Version
+	}
+	c.Version = v
+	return
+}
+
+// Accept() is called by the server to negotiate the version
+func (c *Conn) Accept() (err error) {
+	var v uint16
+	if v, err = c.recvHello(); err != nil {
+		return
+	}
+	if v > Version {
+		v = Version
+	}
+	c.Version = v
+	return c.Send(Hello, hello(v))
+}
+
+func (c *Conn) recvHello() (v uint16, err error) {
+	c.Conn.SetReadDeadline(time.Now().Add(HelloTimeout))
+	defer c.Conn.SetReadDeadline(time.Time{})
+
+	var m *Msg
+	if m, err = c.Recv(); err != nil {
+		err = fmt.Errorf("%w: no hello, %v", ErrVersion, err)
+		return
+	}
+	if m.Type != Hello || len(m.Payload) != len(magic)+2 || !bytes.Equal(m.Payload[:len(magic)], magic) {
+		err = fmt.Errorf("%w: bad hello", ErrVersion)
+		return
+	}
+	v = binary.BigEndian.Uint16(m.Payload[len(magic):])
+	if v < MinVersion {
+		c.Send(Error, []byte(fmt.Sprintf("version %d not supported", v)))
+		err = fmt.Errorf("%w: %d", ErrVersion, v)
+	}
+	return
+}
+
+func hello(v uint16) (b []byte) {
+	b = make([]byte, len(magic)+2)
+	copy(b, magic)
+	binary.BigEndian.PutUint16(b[len(magic):], v)
+	return
+}
@@ -0,0 +1,136 @@
+package wire
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"io"
+	"net"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+func TestReadSplitAndCoalesced(t *testing.T) {
+	buf := &bytes.Buffer{}
+	names := []string{"/ram/1.pcm", "/ram/2.pcm", ""}
+	for _, n := range names {
+		if err := Write(buf, Audio, []byte(n)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// all the messages in one segment, read byte by byte
+	r := iotest.OneByteReader(bytes.NewReader(buf.Bytes()))
+	for _, n := range names {
+		m, err := Read(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if m.Type != Audio || string(m.Payload) != n {
+			t.Fatal("unexpected", m.Type, string(m.Payload))
+		}
+	}
+	if _, err := Read(r); err != io.EOF {
+		t.Fatal("EOF expected, got", err)
+	}
+}
+
+func TestTooLarge(t *testing.T) {
+	if err := Write(io.Discard, Frame, make([]byte, MaxPayload+1)); err != ErrTooLarge {
+		t.Fatal("ErrTooLarge expected, got", err)
+	}
+	hdr := []byte{byte(Frame), 0xff, 0xff, 0xff, 0xff}
+	if _, err := Read(bytes.NewReader(hdr)); err != ErrTooLarge {
+		t.Fatal("ErrTooLarge expected, got", err)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	a, b := net.Pipe()
+	cli, srv := NewConn(a), NewConn(b)
+	defer cli.Close()
+	defer srv.Close()
+
+	done := make(chan error, 1)
+	go func() { done <- srv.Accept() }()
+
+	if err := cli.Hello(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if cli.Version != Version || srv.Version != Version {
+		t.Fatal("versions", cli.Version, srv.Version)
+	}
+
+	go cli.Send(Init, []byte(`{"fps":24}`))
+	m, err := srv.Recv()
+	if err != nil || m.Type != Init || string(m.Payload) != `{"fps":24}` {
+		t.Fatal("unexpected", m, err)
+	}
+}
+
+func TestOldServer(t *testing.T) {
+	a, b := net.Pipe()
+	cli := NewConn(a)
+	defer cli.Close()
+
+	// legacy server reads raw json and never replies with a hello
+	go func() {
+		p := make([]byte, 1024)
+		b.Read(p)
+		b.Write([]byte("/ram/0.png"))
+		b.Close()
+	}()
+
+	if err := cli.Hello(); !errors.Is(err, ErrVersion) {
+		t.Fatal("ErrVersion expected, got", err)
+	}
+}
+
+func TestImage(t *testing.T) {
+	// 2x2, red
+	rgb := []byte{255, 0, 0, 255, 0, 0, 255, 0, 0, 255, 0, 0}
+	img, err := DecodeImage(EncodeImage(RGB, 2, 2, rgb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, g, b, _ := img.At(1, 1).RGBA(); r != 0xffff || g != 0 || b != 0 {
+		t.Fatal("unexpected color", r, g, b)
+	}
+
+	buf := &bytes.Buffer{}
+	if err = png.Encode(buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if img, err = DecodeImage(EncodeImage(PNG, 2, 2, buf.Bytes())); err != nil || img.Bounds().Dx() != 2 {
+		t.Fatal("png", err)
+	}
+
+	if img, err = DecodeImage(EncodeImage(I420, 4, 2, make([]byte, 4*2+2*2*1))); err != nil || img.Bounds().Dy() != 2 {
+		t.Fatal("i420", err)
+	}
+	if _, err = DecodeImage(EncodeImage(RGB, 4, 4, rgb)); err != ErrImage {
+		t.Fatal("ErrImage expected, got", err)
+	}
+}
+
+func TestChunk(t *testing.T) {
+	media, data, err := DecodeChunk(EncodeChunk(1250*time.Millisecond, []byte("1.pcm")))
+	if err != nil || media != 1250*time.Millisecond || string(data) != "1.pcm" {
+		t.Fatal("unexpected", media, string(data), err)
+	}
+	if _, _, err = DecodeChunk([]byte{1}); err != ErrChunk {
+		t.Fatal("ErrChunk expected, got", err)
+	}
+
+	media, d, err := DecodeIdle(EncodeIdle(time.Second, 50*time.Millisecond))
+	if err != nil || media != time.Second || d != 50*time.Millisecond {
+		t.Fatal("unexpected idle", media, d, err)
+	}
+	if _, _, err = DecodeIdle(EncodeChunk(0, nil)); err != ErrChunk {
+		t.Fatal("ErrChunk expected, got", err)
+	}
+}